@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"errors"
+	"log"
+	"os"
+
+	"github.com/amine7536/reverse-scan/pkg/scanner"
+	"github.com/amine7536/reverse-scan/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+// maxReported is the number of gaps and overlaps logged by merge
+const maxReported = 10
+
+func init() {
+	rootCmd.AddCommand(mergeCmd)
+}
+
+var mergeCmd = &cobra.Command{
+	Use:   "merge [flags] SHARD_OUTPUT...",
+	Short: "Merge the outputs of the shards of a scan",
+	Long: `Merge the outputs of the shards of a scan into --output, sorted by IP with
+one row per address. The targets of the scan are passed with the same flags or
+--config as the shards, without --shard, to report the addresses no shard scanned.`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  merge,
+}
+
+func merge(cmd *cobra.Command, args []string) {
+	c, err := loadConfig(cmd)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if c.Shards > 0 {
+		log.Fatal(errors.New("merge covers every shard, remove --shard"))
+	}
+
+	// gaps are found walking the addresses in ascending order
+	expected := c.Hosts
+	if p, ok := expected.(utils.Permutation); ok {
+		expected = p.Hosts
+	}
+
+	file, err := os.Create(c.CSV)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	report, err := scanner.Merge(file, c.Format, args, expected)
+	if err != nil {
+		closeFile(file)
+		log.Fatalf("Merge failed: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		log.Fatalf("Merge failed: %v", err)
+	}
+
+	log.Printf("Merged %v outputs into %v rows in %s", len(args), report.Rows, c.CSV)
+	if report.Duplicates > 0 {
+		log.Printf("Overlaps: dropped %v duplicate rows of IPs found in several outputs", report.Duplicates)
+		logRanges(report.Overlaps)
+	}
+	if report.Missing > 0 {
+		log.Printf("Gaps: %v of %v IPs are missing", report.Missing, expected.Size())
+		logRanges(report.Gaps)
+	}
+	if report.Unexpected > 0 {
+		log.Printf("Warning: %v rows are IPs outside of the targets", report.Unexpected)
+	}
+	if report.Duplicates == 0 && report.Missing == 0 {
+		log.Printf("No gaps or overlaps")
+	}
+}
+
+// logRanges logs the first ranges of a merge report
+func logRanges(rs []utils.Range) {
+	for i, r := range rs {
+		if i == maxReported {
+			log.Printf("  ... and %v more", len(rs)-maxReported)
+			return
+		}
+		if r.Start == r.End {
+			log.Printf("  %v", r.Start)
+		} else {
+			log.Printf("  %v", r)
+		}
+	}
+}
+
+// closeFile closes a file on an error path
+func closeFile(file *os.File) {
+	//nolint:errcheck
+	file.Close()
+}
@@ -2,14 +2,30 @@
 package cmd
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/amine7536/reverse-scan/pkg/config"
+	"github.com/amine7536/reverse-scan/pkg/estimate"
 	"github.com/amine7536/reverse-scan/pkg/scanner"
+	"github.com/amine7536/reverse-scan/pkg/utils"
+	"github.com/gosuri/uiprogress"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
+// exitInterrupted is the exit status of an interrupted scan, the one of a
+// shell command killed by SIGINT
+const exitInterrupted = 130
+
 var rootCmd = cobra.Command{
 	Use:   "reverse-scan",
 	Short: "Reverse Scan",
@@ -23,21 +39,245 @@ func NewRootCmd(v string) *cobra.Command {
 	// Set Version and ProgramName
 	version = v
 
+	defaults := config.DefaultOptions()
+	rootCmd.PersistentFlags().String("config", "", "JSON or TOML config file, its settings are named after the flags (env "+config.EnvName("config")+")")
 	rootCmd.PersistentFlags().StringP("start", "s", "", "ip range start")
 	rootCmd.PersistentFlags().StringP("end", "e", "", "ip range end")
-	rootCmd.PersistentFlags().StringP("cidr", "c", "", "CIDR notation (e.g., 192.168.1.0/24)")
-	rootCmd.PersistentFlags().StringP("output", "o", "", "csv output file")
-	rootCmd.PersistentFlags().IntP("workers", "w", 8, "number of workers")
+	rootCmd.PersistentFlags().StringSliceP("cidr", "c", nil, "CIDR notation (e.g., 192.168.1.0/24), repeatable")
+	rootCmd.PersistentFlags().String("targets", "", "file of CIDRs, start-end ranges and IPs, one per line, - reads stdin")
+	rootCmd.PersistentFlags().StringSlice("exclude", nil, "CIDR, start-end range or IP never to query, repeatable")
+	rootCmd.PersistentFlags().String("exclude-file", "", "file of CIDRs, start-end ranges and IPs never to query, one per line")
+	rootCmd.PersistentFlags().Bool("skip-network-broadcast", false, "skip the network and broadcast addresses of IPv4 CIDR targets up to /30")
+	rootCmd.PersistentFlags().StringSlice("skip-pattern", nil, "skip the IPv4 addresses ending with these last bytes, e.g. .0,.255 or .250-.255")
+	rootCmd.PersistentFlags().Bool("randomize", false, "scan the addresses in a pseudo-random order, spreading the queries over the reverse zones")
+	rootCmd.PersistentFlags().Uint64("seed", 0, "seed of the --randomize order and of the samples, runs with the same seed scan the same addresses in the same order (default random)")
+	rootCmd.PersistentFlags().Float64("sample", 0, "scan a share of the addresses spread over the targets, e.g. 0.01, and estimate the naming of all of them")
+	rootCmd.PersistentFlags().Int("sample-per-24", 0, "scan this number of random IPv4 addresses per /24 and estimate the naming of all of them")
+	rootCmd.PersistentFlags().String("shard", "", "scan only the N-th of M slices of the addresses, N/M, to split a scan across machines")
+	rootCmd.PersistentFlags().StringP("output", "o", "", "output file")
+	rootCmd.PersistentFlags().String("format", defaults.Format, "output format: "+strings.Join(scanner.Formats(), ", "))
+	rootCmd.PersistentFlags().Bool("sorted", false, "write the results in the order of the IPs instead of the order lookups complete")
+	rootCmd.PersistentFlags().StringP("workers", "w", strconv.Itoa(defaults.Workers), "number of workers, or auto to tune it while scanning from the latency and the failures of the lookups")
+	rootCmd.PersistentFlags().Int("workers-min", defaults.WorkersMin, "minimum number of workers with --workers auto, the scan starts with it")
+	rootCmd.PersistentFlags().Int("workers-max", defaults.WorkersMax, "maximum number of workers with --workers auto")
+	rootCmd.PersistentFlags().Bool("resume", false, "resume an interrupted scan from its checkpoint, appending to the output")
+	rootCmd.PersistentFlags().String("checkpoint", "", "checkpoint file (default <output>.checkpoint)")
+	rootCmd.PersistentFlags().Duration("checkpoint-interval", defaults.CheckpointInterval, "interval between two checkpoints")
+	rootCmd.PersistentFlags().StringSlice("resolver", nil, "nameserver host:port to query directly, repeatable (default system resolver)")
+	rootCmd.PersistentFlags().Bool("tcp", false, "query resolvers over TCP only")
+	rootCmd.PersistentFlags().Duration("timeout", defaults.Timeout, "timeout of every lookup")
+	rootCmd.PersistentFlags().Float64("rate", 0, "maximum queries per second shared by all workers (default no limit)")
+	rootCmd.PersistentFlags().Int("burst", 0, "queries allowed above --rate in a burst (default 1)")
+	rootCmd.PersistentFlags().Bool("rate-adaptive", false, "lower the rate while resolvers refuse or drop queries")
+	rootCmd.PersistentFlags().Int("max-attempts", defaults.MaxAttempts, "maximum number of lookups per IP, 1 disables retries")
+	rootCmd.PersistentFlags().Duration("retry-delay", defaults.RetryDelay, "base backoff before a retry, doubled on every retry")
+	rootCmd.PersistentFlags().StringSlice("retry-on", defaults.RetryOn, "lookup statuses to retry: servfail, refused, timeout, other")
+	rootCmd.PersistentFlags().String("v6-strategy", defaults.V6Strategy, "IPv6 address selection: full, lowbyte, eui64 or seed")
+	rootCmd.PersistentFlags().Int("v6-lowbyte", defaults.V6LowByte, "number of low-byte addresses (::1 to ::n) per /64 with --v6-strategy lowbyte")
+	rootCmd.PersistentFlags().String("v6-hints", "", "file of MAC addresses (eui64) or IPs (seed), one per line")
 
 	return &rootCmd
 }
 
 func run(cmd *cobra.Command, _ []string) {
-	c, err := config.LoadConfig(cmd)
+	c, err := loadConfig(cmd)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	scanner.Start(c)
-	os.Exit(0)
+	var bar *uiprogress.Bar
+	progress := func(done, total uint64) {
+		if bar == nil {
+			uiprogress.Start()
+			bar = uiprogress.AddBar(int(total))
+			bar.AppendCompleted()
+			bar.PrependElapsed()
+		}
+		bar.Incr()
+	}
+
+	opts := []scanner.Option{
+		scanner.WithConfig(c),
+		scanner.WithLogger(log.Default()),
+		scanner.WithProgress(progress),
+	}
+
+	var est *estimate.Estimator
+	if c.Population > 0 {
+		est = estimate.New()
+		opts = append(opts, scanner.WithResults(func(r scanner.Result) {
+			est.Add(r.IP, r.Status, r.Names)
+		}))
+	}
+
+	s, err := scanner.New(opts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	logPlan(c)
+
+	// Stop on SIGINT/SIGTERM, a second signal kills the process right away
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	finished := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			log.Printf("Interrupted, waiting for in-flight lookups (interrupt again to abort)")
+			stop()
+		case <-finished:
+		}
+	}()
+
+	summary, err := s.Run(ctx)
+	close(finished)
+	if bar != nil {
+		uiprogress.Stop()
+	}
+	if err != nil && !errors.Is(err, context.Canceled) {
+		log.Fatalf("Scan failed: %v", err)
+	}
+
+	if !summary.Complete() {
+		log.Printf("Scan interrupted after %v of %v IPs, run again with --resume to continue", summary.Done(), summary.Total)
+	}
+	log.Printf("Scanned %v of %v unique IPs in %v", summary.Scanned, summary.Total, summary.Duration.Round(time.Millisecond))
+	log.Printf("Lookup statuses: %s", summary.FormatStatuses())
+	if summary.Panics > 0 {
+		log.Printf("Warning: %v lookups panicked, their stack traces are logged above", summary.Panics)
+	}
+
+	if est != nil {
+		if summary.Resumed > 0 {
+			log.Printf("Warning: the estimates only cover the %v IPs scanned by this run", summary.Scanned)
+		}
+		logEstimates(est.Report(c.Population), c.Population)
+	}
+
+	// scripts tell a partial output from a complete one by the exit status
+	if !summary.Complete() {
+		os.Exit(exitInterrupted)
+	}
+}
+
+// logEstimates logs what a sample tells about the naming of the targets
+func logEstimates(r estimate.Report, population uint64) {
+	log.Printf("Estimates from %v of %v IPs, with 95%% confidence intervals:", r.Sampled-r.Failed, population)
+	if r.Failed > 0 {
+		log.Printf("  %v failed lookups left out", r.Failed)
+	}
+	log.Printf("  PTR coverage: %s", formatShare(r.Coverage))
+	log.Printf("  Named IPs: %.0f [%.0f-%.0f]", r.Named.Estimate, r.Named.Low, r.Named.High)
+	for i, p := range r.Patterns {
+		if i == maxReported {
+			log.Printf("  ... and %v more patterns", len(r.Patterns)-maxReported)
+			break
+		}
+		log.Printf("  Pattern %s: %s of the names", p.Pattern, formatShare(p.Share))
+	}
+	if r.Blocks > 0 {
+		log.Printf("  /24s with names: %v of %v sampled", r.NamedBlocks, r.Blocks)
+		log.Printf("  Named IPs per /24: %s", formatShare(r.Density))
+		log.Printf("  /24s per share of named IPs: 0%%: %v, up to 25%%: %v, 50%%: %v, 75%%: %v, 100%%: %v",
+			r.Densities[0], r.Densities[1], r.Densities[2], r.Densities[3], r.Densities[4])
+	}
+}
+
+// formatShare renders a share and its interval as percentages
+func formatShare(i estimate.Interval) string {
+	return fmt.Sprintf("%.1f%% [%.1f%%-%.1f%%]", 100*i.Estimate, 100*i.Low, 100*i.High)
+}
+
+// logPlan logs what the scan is about to do
+func logPlan(c *config.Config) {
+	if len(c.Targets) == 1 {
+		log.Printf("Resolving from %v to %v", c.StartIP, c.EndIP)
+	} else {
+		log.Printf("Resolving %v targets merged into %v ranges from %v to %v", c.TargetCount, len(c.Targets), c.StartIP, c.EndIP)
+	}
+	if c.CIDR != "" {
+		log.Printf("Covering CIDR is %s", c.CIDR)
+	}
+	if c.Excluded > 0 {
+		log.Printf("Excluded %v IPs from the targets", c.Excluded)
+	}
+	if c.Skipped > 0 {
+		log.Printf("Skipped %v network and broadcast IPs", c.Skipped)
+	}
+	if len(c.SkipLastBytes) > 0 {
+		log.Printf("Skipping IPv4 addresses ending with %v", c.SkipLastBytes)
+	}
+	if shard, ok := c.Hosts.(utils.Shard); ok {
+		log.Printf("Scanning shard %v/%v, %v of the %v unique IPs", c.Shard, c.Shards, shard.Size(), shard.Hosts.Size())
+	}
+	switch {
+	case c.SampleRate > 0:
+		log.Printf("Sampling %v%% of the %v unique IPs", 100*c.SampleRate, c.Population)
+	case c.SamplePerBlock > 0:
+		log.Printf("Sampling %v IPs per /24 of the %v unique IPs", c.SamplePerBlock, c.Population)
+	}
+	log.Printf("Number of unique IPs to scan: %v", c.Hosts.Size())
+	if c.Randomize {
+		log.Printf("Randomizing the scan order")
+	}
+	if c.Sorted {
+		log.Printf("Writing the results in the order of the IPs")
+	}
+	if c.Seed != 0 {
+		log.Printf("Using seed %v, pass --seed %v to resume or repeat the scan", c.Seed, c.Seed)
+	}
+	if len(c.Resolvers) > 0 {
+		log.Printf("Querying resolvers %v", c.Resolvers)
+	}
+	if c.Retry.MaxAttempts > 1 {
+		log.Printf("Retrying %v up to %v attempts", c.Retry.RetryOn, c.Retry.MaxAttempts)
+	}
+	if c.Rate > 0 {
+		log.Printf("Limiting rate to %v queries/s", c.Rate)
+	}
+	if c.WorkersMax > 0 {
+		log.Printf("Starting %v Workers, tuned up to %v while scanning", c.WORKERS, c.WorkersMax)
+	} else {
+		log.Printf("Starting %v Workers", c.WORKERS)
+	}
+}
+
+// loadConfig layers the settings of the config file, the environment then
+// the flags set on the command line over the defaults
+func loadConfig(cmd *cobra.Command) (*config.Config, error) {
+	o := config.DefaultOptions()
+
+	path, err := cmd.Flags().GetString("config")
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		path = os.Getenv(config.EnvName("config"))
+	}
+	if path != "" {
+		if err := o.LoadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := o.LoadEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		if err != nil || f.Name == "config" {
+			return
+		}
+		value := f.Value.String()
+		if list, ok := f.Value.(pflag.SliceValue); ok {
+			value = strings.Join(list.GetSlice(), ",")
+		}
+		err = o.Set(f.Name, value)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return config.New(o)
 }
@@ -3,14 +3,16 @@ module github.com/amine7536/reverse-scan
 go 1.25
 
 require (
+	github.com/BurntSushi/toml v1.5.0
 	github.com/gosuri/uiprogress v0.0.1
 	github.com/spf13/cobra v1.10.2
+	github.com/spf13/pflag v1.0.10
+	golang.org/x/net v0.47.0
 )
 
 require (
 	github.com/gosuri/uilive v0.0.4 // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
-	github.com/spf13/pflag v1.0.10 // indirect
 	golang.org/x/sys v0.38.0 // indirect
 )
@@ -0,0 +1,143 @@
+// Package checkpoint records the progress of a scan so an interrupted scan can be resumed
+package checkpoint
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// version of the checkpoint file format
+const version = 1
+
+// Interval is an inclusive span of sequence numbers, the positions of the
+// addresses in the scan order
+type Interval struct {
+	First uint64 `json:"first"`
+	Last  uint64 `json:"last"`
+}
+
+// Checkpoint is the progress of a scan. Results arrive out of order so the
+// completed addresses are kept as sorted, non-overlapping intervals of their
+// sequence numbers. Offset is the size of the output file holding exactly
+// the results of the completed addresses.
+type Checkpoint struct {
+	// Scan identifies the scan settings, a checkpoint only resumes the same scan
+	Scan    string     `json:"scan"`
+	Done    []Interval `json:"done"`
+	Version int        `json:"version"`
+	Total   uint64     `json:"total"`
+	Offset  int64      `json:"offset"`
+}
+
+// New returns an empty checkpoint for a scan of total addresses
+func New(scan string, total uint64) *Checkpoint {
+	return &Checkpoint{Version: version, Scan: scan, Total: total}
+}
+
+// Load reads a checkpoint file
+func Load(path string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var c Checkpoint
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint %q: %w", path, err)
+	}
+
+	if c.Version != version {
+		return nil, fmt.Errorf("invalid checkpoint %q: unsupported version %d", path, c.Version)
+	}
+
+	return &c, nil
+}
+
+// Save writes the checkpoint to path, atomically replacing the previous one
+func (c *Checkpoint) Save(path string) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		//nolint:errcheck
+		tmp.Close()
+		//nolint:errcheck
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		//nolint:errcheck
+		tmp.Close()
+		//nolint:errcheck
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		//nolint:errcheck
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// MarkDone records the address at position seq as completed
+func (c *Checkpoint) MarkDone(seq uint64) {
+	// i is the first interval starting after seq
+	i := sort.Search(len(c.Done), func(i int) bool { return c.Done[i].First > seq })
+
+	if i > 0 && c.Done[i-1].Last >= seq {
+		return
+	}
+
+	joinPrev := i > 0 && c.Done[i-1].Last+1 == seq
+	joinNext := i < len(c.Done) && c.Done[i].First == seq+1
+
+	switch {
+	case joinPrev && joinNext:
+		c.Done[i-1].Last = c.Done[i].Last
+		c.Done = append(c.Done[:i], c.Done[i+1:]...)
+	case joinPrev:
+		c.Done[i-1].Last = seq
+	case joinNext:
+		c.Done[i].First = seq
+	default:
+		c.Done = append(c.Done, Interval{})
+		copy(c.Done[i+1:], c.Done[i:])
+		c.Done[i] = Interval{First: seq, Last: seq}
+	}
+}
+
+// IsDone reports whether the address at position seq is completed
+func (c *Checkpoint) IsDone(seq uint64) bool {
+	i := sort.Search(len(c.Done), func(i int) bool { return c.Done[i].First > seq })
+	return i > 0 && c.Done[i-1].Last >= seq
+}
+
+// Count returns the number of completed addresses
+func (c *Checkpoint) Count() uint64 {
+	var n uint64
+	for _, in := range c.Done {
+		n += in.Last - in.First + 1
+	}
+	return n
+}
+
+// Clone returns a copy of the checkpoint that does not share its intervals
+func (c *Checkpoint) Clone() *Checkpoint {
+	clone := *c
+	clone.Done = append([]Interval(nil), c.Done...)
+	return &clone
+}
@@ -0,0 +1,168 @@
+package checkpoint
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMarkDone(t *testing.T) {
+	tests := []struct {
+		name string
+		seqs []uint64
+		want []Interval
+	}{
+		{
+			name: "in order",
+			seqs: []uint64{0, 1, 2, 3},
+			want: []Interval{{0, 3}},
+		},
+		{
+			name: "out of order",
+			seqs: []uint64{3, 0, 2, 1},
+			want: []Interval{{0, 3}},
+		},
+		{
+			name: "gaps",
+			seqs: []uint64{0, 1, 5, 6, 9},
+			want: []Interval{{0, 1}, {5, 6}, {9, 9}},
+		},
+		{
+			name: "gap filled",
+			seqs: []uint64{0, 1, 3, 4, 2},
+			want: []Interval{{0, 4}},
+		},
+		{
+			name: "duplicates",
+			seqs: []uint64{5, 5, 4, 5, 6},
+			want: []Interval{{4, 6}},
+		},
+		{
+			name: "insert before",
+			seqs: []uint64{10, 5, 1},
+			want: []Interval{{1, 1}, {5, 5}, {10, 10}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New("scan", 100)
+			for _, seq := range tt.seqs {
+				c.MarkDone(seq)
+			}
+
+			if len(c.Done) != len(tt.want) {
+				t.Fatalf("Done = %v, want %v", c.Done, tt.want)
+			}
+			for i := range tt.want {
+				if c.Done[i] != tt.want[i] {
+					t.Errorf("Done[%d] = %v, want %v", i, c.Done[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestIsDoneAndCount(t *testing.T) {
+	c := New("scan", 100)
+	for _, seq := range []uint64{0, 1, 2, 10, 11, 50} {
+		c.MarkDone(seq)
+	}
+
+	for seq, want := range map[uint64]bool{0: true, 2: true, 3: false, 9: false, 10: true, 11: true, 12: false, 50: true, 99: false} {
+		if got := c.IsDone(seq); got != want {
+			t.Errorf("IsDone(%d) = %v, want %v", seq, got, want)
+		}
+	}
+
+	if got := c.Count(); got != 6 {
+		t.Errorf("Count() = %v, want 6", got)
+	}
+}
+
+func TestClone(t *testing.T) {
+	c := New("scan", 100)
+	c.MarkDone(1)
+
+	clone := c.Clone()
+	c.MarkDone(2)
+	c.MarkDone(5)
+
+	if clone.IsDone(2) || clone.IsDone(5) || !clone.IsDone(1) {
+		t.Errorf("Clone() shares its intervals: %v", clone.Done)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scan.checkpoint")
+
+	c := New("abc", 1000)
+	c.Offset = 4242
+	for _, seq := range []uint64{0, 1, 2, 7, 999} {
+		c.MarkDone(seq)
+	}
+
+	if err := c.Save(path); err != nil {
+		t.Fatalf("Save() unexpected error = %v", err)
+	}
+
+	// saving again replaces the file
+	c.MarkDone(3)
+	if err := c.Save(path); err != nil {
+		t.Fatalf("Save() unexpected error = %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() unexpected error = %v", err)
+	}
+
+	if loaded.Scan != "abc" || loaded.Total != 1000 || loaded.Offset != 4242 {
+		t.Errorf("Load() = %+v, want scan abc, total 1000, offset 4242", loaded)
+	}
+	if loaded.Count() != 6 || !loaded.IsDone(3) || !loaded.IsDone(999) {
+		t.Errorf("Load() Done = %v", loaded.Done)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatalf("ReadDir() unexpected error = %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Save() left %d files, want 1", len(entries))
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{
+			name:    "not JSON",
+			content: "not a checkpoint",
+		},
+		{
+			name:    "unknown version",
+			content: `{"version": 99, "scan": "abc"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "invalid.checkpoint")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+			if _, err := Load(path); err == nil {
+				t.Error("Load() should error on invalid checkpoint")
+			}
+		})
+	}
+
+	if _, err := Load(filepath.Join(dir, "missing")); err == nil {
+		t.Error("Load() should error on missing file")
+	}
+}
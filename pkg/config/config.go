@@ -3,69 +3,176 @@ package config
 
 import (
 	"fmt"
+	"io"
+	"math/bits"
+	"math/rand/v2"
 	"net"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/amine7536/reverse-scan/pkg/resolver"
 	"github.com/amine7536/reverse-scan/pkg/utils"
-
-	"github.com/spf13/cobra"
 )
 
 // Config the application's configuration
 type Config struct {
-	CIDR    string
+	// CIDR is the smallest prefix covering a single target range, for display only
+	CIDR string
+	// CSV is the output file, written in Format
 	CSV     string
+	Format  string
 	StartIP net.IP
 	EndIP   net.IP
+	// Targets are the merged ranges to scan
+	Targets utils.Ranges
+	// TargetCount is the number of targets given, before merging
+	TargetCount int
+	// Prefixes are the CIDR targets, before merging
+	Prefixes []netip.Prefix
+	// HostRanges are the ranges of every target before merging, less the
+	// network and broadcast addresses of the IPv4 CIDRs
+	HostRanges []utils.Range
+	// Excluded is the number of target addresses removed by the exclusions
+	Excluded uint64
+	// Skipped is the number of network and broadcast addresses removed from the targets
+	Skipped uint64
+	// SkipLastBytes drops the IPv4 addresses ending with one of these bytes
+	SkipLastBytes []byte
+	// Hosts enumerates the addresses of Targets that will be scanned
+	Hosts utils.Generator
+	// Seed sets the order of the addresses when Randomize is on and the
+	// addresses drawn by a sample
+	Seed uint64
+	// SampleRate is the share of the addresses sampled, SamplePerBlock the
+	// number of addresses sampled per /24, the scan is not sampled when both are zero
+	SampleRate     float64
+	SamplePerBlock int
+	// Population is the number of addresses a sample was drawn from
+	Population uint64
+	// Shard is the 1-based slice of the addresses scanned out of Shards, the
+	// scan is not sharded when Shards is zero
+	Shard     uint64
+	Shards    uint64
+	Randomize bool
+	// Sorted writes the results in the order of the addresses
+	Sorted bool
+	// Resolvers are the host:port nameservers to query, the system resolver is used when empty
+	Resolvers []string
+	TCP       bool
+	// Timeout bounds every lookup
+	Timeout time.Duration
+	Retry   resolver.RetryPolicy
+	// Rate caps the queries per second of all workers, no limit when zero
+	Rate         float64
+	Burst        int
+	AdaptiveRate bool
+	// Checkpoint is the file recording the progress of the scan
+	Checkpoint         string
+	CheckpointInterval time.Duration
+	Resume             bool
+	// WORKERS is the number of workers, the initial one when it is tuned
 	WORKERS int
+	// WorkersMin and WorkersMax bound the number of workers tuned while
+	// scanning, zero when the number is fixed
+	WorkersMin int
+	WorkersMax int
 }
 
-// LoadConfig loads the config from a file if specified, otherwise from the environment
-func LoadConfig(cmd *cobra.Command) (*Config, error) {
+// DefaultFormat is the output format when none is given
+const DefaultFormat = "csv"
+
+// IPv6 address selection strategies
+const (
+	StrategyFull    = "full"
+	StrategyLowByte = "lowbyte"
+	StrategyEUI64   = "eui64"
+	StrategySeed    = "seed"
+)
 
-	start, err := cmd.Flags().GetString("start")
+// New validates the options and returns the configuration of the scan
+func New(o Options) (*Config, error) {
+	stdin := o.Stdin
+	if stdin == nil {
+		stdin = os.Stdin
+	}
+	targets, err := readTargets(o.Targets, stdin)
 	if err != nil {
 		return nil, err
 	}
 
-	end, err := cmd.Flags().GetString("end")
+	config, err := validateConfig(o.Start, o.End, o.CIDRs, targets, o.Output, o.Workers)
 	if err != nil {
 		return nil, err
 	}
 
-	cidr, err := cmd.Flags().GetString("cidr")
-	if err != nil {
+	if err := validateExclude(config, o.Exclude, o.ExcludeFile); err != nil {
 		return nil, err
 	}
 
-	output, err := cmd.Flags().GetString("output")
-	if err != nil {
+	if err := validateSkip(config, o.SkipNetworkBroadcast, o.SkipPattern); err != nil {
 		return nil, err
 	}
 
-	workers, err := cmd.Flags().GetInt("workers")
-	if err != nil {
+	if err := validateFormat(config, o.Format); err != nil {
 		return nil, err
 	}
 
-	config, err := validateConfig(start, end, cidr, output, workers)
-	if err != nil {
+	if err := validateCheckpoint(config, o.Checkpoint, o.CheckpointInterval, o.Resume); err != nil {
+		return nil, err
+	}
+
+	if err := validateRate(config, o.Rate, o.Burst, o.RateAdaptive); err != nil {
+		return nil, err
+	}
+
+	if err := validateWorkers(config, o.WorkersAuto, o.WorkersMin, o.WorkersMax); err != nil {
+		return nil, err
+	}
+
+	if err := validateLookup(config, o.Timeout, o.MaxAttempts, o.RetryDelay, o.RetryOn); err != nil {
+		return nil, err
+	}
+
+	if err := validateResolvers(config, o.Resolvers, o.TCP); err != nil {
+		return nil, err
+	}
+
+	if err := validateStrategy(config, o.V6Strategy, o.V6LowByte, o.V6Hints); err != nil {
+		return nil, err
+	}
+
+	if err := validateSample(config, o.Sample, o.SamplePer24, o.Seed); err != nil {
+		return nil, err
+	}
+
+	if err := validateOrder(config, o.Randomize, o.Sorted, o.Seed); err != nil {
+		return nil, err
+	}
+
+	if err := validateShard(config, o.Shard, o.Seed); err != nil {
 		return nil, err
 	}
 
 	return config, nil
 }
 
-func validateConfig(start, end, cidr, output string, workers int) (*Config, error) {
-	// Check that either CIDR or (start and end) are provided, but not both
-	hasCIDR := cidr != ""
+// validateConfig parses the targets, a --start/--end range or any number of
+// --cidr prefixes and --targets entries, and merges them
+func validateConfig(start, end string, cidrs, targets []string, output string, workers int) (*Config, error) {
+	// Check that either targets or (start and end) are provided, but not both
+	hasTargets := len(cidrs) > 0 || len(targets) > 0
 	hasStartEnd := start != "" || end != ""
 
-	if !hasCIDR && !hasStartEnd {
-		return nil, fmt.Errorf("must specify either --cidr or --start/--end range")
+	if !hasTargets && !hasStartEnd {
+		return nil, fmt.Errorf("must specify either --cidr, --targets or --start/--end range")
 	}
 
-	if hasCIDR && hasStartEnd {
-		return nil, fmt.Errorf("cannot specify both --cidr and --start/--end range")
+	if hasTargets && hasStartEnd {
+		return nil, fmt.Errorf("cannot specify both --cidr or --targets and --start/--end range")
 	}
 
 	if output == "" {
@@ -76,27 +183,32 @@ func validateConfig(start, end, cidr, output string, workers int) (*Config, erro
 		return nil, fmt.Errorf("invalid output file: %q", output)
 	}
 
-	var startIP, endIP net.IP
-	var cidrStr string
+	var ranges, hosts []utils.Range
+	var prefixes []netip.Prefix
 
-	if hasCIDR {
-		// Parse CIDR notation
-		ip, ipnet, err := net.ParseCIDR(cidr)
-		if err != nil {
-			return nil, fmt.Errorf("invalid CIDR notation %q: %w", cidr, err)
+	if hasTargets {
+		for _, cidr := range cidrs {
+			p, err := netip.ParsePrefix(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR notation %q: %w", cidr, err)
+			}
+			ranges = append(ranges, utils.PrefixRange(p))
+			hosts = append(hosts, utils.HostRange(p))
+			prefixes = append(prefixes, p)
 		}
 
-		// Get the first IP in the range
-		startIP = ip.Mask(ipnet.Mask)
-
-		// Get the last IP in the range
-		endIP = make(net.IP, len(startIP))
-		copy(endIP, startIP)
-		for i := range endIP {
-			endIP[i] |= ^ipnet.Mask[i]
+		for _, target := range targets {
+			r, err := utils.ParseTarget(target)
+			if err != nil {
+				return nil, fmt.Errorf("invalid --targets entry: %w", err)
+			}
+			ranges = append(ranges, r)
+			if p, err := netip.ParsePrefix(strings.TrimSpace(target)); err == nil {
+				r = utils.HostRange(p)
+				prefixes = append(prefixes, p)
+			}
+			hosts = append(hosts, r)
 		}
-
-		cidrStr = cidr
 	} else {
 		// Validate start and end IPs
 		if start == "" {
@@ -107,35 +219,531 @@ func validateConfig(start, end, cidr, output string, workers int) (*Config, erro
 			return nil, fmt.Errorf("must specify end range")
 		}
 
-		var err error
-		startIP, err = utils.IsValidIP(start)
+		startIP, err := utils.IsValidIP(start)
 		if err != nil {
 			return nil, err
 		}
 
-		endIP, err = utils.IsValidIP(end)
+		endIP, err := utils.IsValidIP(end)
 		if err != nil {
 			return nil, err
 		}
 
-		if startIP[0] != endIP[0] {
-			return nil, fmt.Errorf("invalid range: start and end IP must be in the same network")
+		// Scan exactly from start to end, not the covering CIDR
+		r, err := utils.NewRange(startIP, endIP)
+		if err != nil {
+			return nil, err
 		}
+		ranges = append(ranges, r)
+		hosts = append(hosts, r)
+	}
+
+	merged := utils.MergeRanges(ranges)
+	config := Config{
+		Format:      DefaultFormat,
+		StartIP:     merged[0].Start.AsSlice(),
+		EndIP:       merged[len(merged)-1].End.AsSlice(),
+		Targets:     merged,
+		TargetCount: len(ranges),
+		Prefixes:    prefixes,
+		HostRanges:  hosts,
+		Hosts:       merged,
+		CSV:         output,
+		WORKERS:     workers,
+	}
+
+	switch {
+	case len(cidrs) == 1 && len(targets) == 0:
+		config.CIDR = cidrs[0]
+	case len(merged) == 1:
+		config.CIDR = utils.GetCIDR(config.StartIP, config.EndIP)
+	}
+
+	return &config, nil
+}
 
-		if endIP[2] < startIP[2] {
-			return nil, fmt.Errorf("invalid range: end IP must be greater than start IP")
+// validateExclude removes the --exclude and --exclude-file ranges from the targets
+func validateExclude(config *Config, exclude []string, file string) error {
+	entries := slices.Clone(exclude)
+	if file != "" {
+		lines, err := utils.ReadLines(file)
+		if err != nil {
+			return fmt.Errorf("failed to read --exclude-file: %w", err)
 		}
+		entries = append(entries, lines...)
+	}
 
-		cidrStr = utils.GetCIDR(startIP, endIP)
+	if len(entries) == 0 {
+		return nil
 	}
 
-	config := Config{
-		StartIP: startIP,
-		EndIP:   endIP,
-		CIDR:    cidrStr,
-		CSV:     output,
-		WORKERS: workers,
+	ranges := make([]utils.Range, 0, len(entries))
+	for _, entry := range entries {
+		r, err := utils.ParseTarget(entry)
+		if err != nil {
+			return fmt.Errorf("invalid exclusion: %w", err)
+		}
+		ranges = append(ranges, r)
 	}
 
-	return &config, nil
+	targets := config.Targets.Subtract(utils.MergeRanges(ranges))
+	if len(targets) == 0 {
+		return fmt.Errorf("every target address is excluded")
+	}
+
+	config.Excluded = config.Targets.Size() - targets.Size()
+	setTargets(config, targets)
+
+	return nil
+}
+
+// validateSkip drops the network and broadcast addresses of the IPv4 CIDR
+// targets and checks the last bytes of --skip-pattern. An address another
+// target covers as a host, as 10.0.1.0 inside 10.0.0.0/16, is kept.
+func validateSkip(config *Config, networkBroadcast bool, patterns []string) error {
+	if networkBroadcast {
+		var edges []utils.Range
+		for _, p := range config.Prefixes {
+			r, hosts := utils.PrefixRange(p), utils.HostRange(p)
+			if hosts != r {
+				edges = append(edges, utils.Range{Start: r.Start, End: r.Start}, utils.Range{Start: r.End, End: r.End})
+			}
+		}
+
+		// the host ranges of a prefix leave out its own edges
+		skipped := utils.MergeRanges(edges).Subtract(utils.MergeRanges(config.HostRanges))
+		targets := config.Targets.Subtract(skipped)
+		if len(targets) == 0 {
+			return fmt.Errorf("every target address is a network or broadcast address")
+		}
+
+		config.Skipped = config.Targets.Size() - targets.Size()
+		setTargets(config, targets)
+	}
+
+	if len(patterns) == 0 {
+		return nil
+	}
+
+	if !config.Targets[0].Start.Is4() {
+		return fmt.Errorf("--skip-pattern only applies to IPv4 targets")
+	}
+
+	config.SkipLastBytes = nil
+	for _, pattern := range patterns {
+		first, last, err := parseLastBytes(pattern)
+		if err != nil {
+			return err
+		}
+		for b := first; ; b++ {
+			config.SkipLastBytes = append(config.SkipLastBytes, b)
+			if b == last {
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseLastBytes parses a last byte like .0 or 255, or a range of them like .250-.255
+func parseLastBytes(pattern string) (first, last byte, err error) {
+	parse := func(s string) (byte, error) {
+		b, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimSpace(s), "."), 10, 8)
+		if err != nil {
+			return 0, fmt.Errorf("invalid --skip-pattern %q: must be a last byte like .0 or a range like .250-.255", pattern)
+		}
+		return byte(b), nil
+	}
+
+	start, end, isRange := strings.Cut(pattern, "-")
+	if first, err = parse(start); err != nil {
+		return 0, 0, err
+	}
+	if !isRange {
+		return first, first, nil
+	}
+	if last, err = parse(end); err != nil {
+		return 0, 0, err
+	}
+	if last < first {
+		return 0, 0, fmt.Errorf("invalid --skip-pattern %q: end must not be lower than start", pattern)
+	}
+	return first, last, nil
+}
+
+// setTargets replaces the targets and the addresses to scan
+func setTargets(config *Config, targets utils.Ranges) {
+	config.Targets = targets
+	config.Hosts = targets
+	config.StartIP = targets[0].Start.AsSlice()
+	config.EndIP = targets[len(targets)-1].End.AsSlice()
+}
+
+// readTargets returns the entries of a --targets file, - reads them from stdin
+func readTargets(path string, stdin io.Reader) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	var targets []string
+	var err error
+	if path == "-" {
+		targets, err = utils.ScanLines(stdin)
+	} else {
+		targets, err = utils.ReadLines(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read --targets: %w", err)
+	}
+
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no targets in --targets %q", path)
+	}
+	return targets, nil
+}
+
+// validateLookup checks the timeout and retry settings applied to every lookup
+func validateLookup(config *Config, timeout time.Duration, maxAttempts int, retryDelay time.Duration, retryOn []string) error {
+	if timeout <= 0 {
+		return fmt.Errorf("invalid --timeout %v: must be greater than 0", timeout)
+	}
+
+	if maxAttempts < 1 {
+		return fmt.Errorf("invalid --max-attempts %d: must be at least 1", maxAttempts)
+	}
+
+	if retryDelay < 0 {
+		return fmt.Errorf("invalid --retry-delay %v: must not be negative", retryDelay)
+	}
+
+	statuses, err := resolver.ParseRetryOn(retryOn)
+	if err != nil {
+		return err
+	}
+
+	config.Timeout = timeout
+	config.Retry = resolver.RetryPolicy{
+		MaxAttempts: maxAttempts,
+		BaseDelay:   retryDelay,
+		MaxDelay:    resolver.DefaultRetryMaxDelay,
+		RetryOn:     statuses,
+	}
+
+	return nil
+}
+
+// validateFormat checks the output format is given, the scanner knows which
+// formats are registered
+func validateFormat(config *Config, format string) error {
+	if format == "" {
+		return fmt.Errorf("invalid --format: must not be empty")
+	}
+
+	config.Format = format
+	return nil
+}
+
+// validateCheckpoint checks the checkpoint settings, the checkpoint file
+// defaults to the output file with a .checkpoint extension
+func validateCheckpoint(config *Config, path string, interval time.Duration, resume bool) error {
+	if path == "" {
+		path = config.CSV + ".checkpoint"
+	}
+
+	if interval <= 0 {
+		return fmt.Errorf("invalid --checkpoint-interval %v: must be greater than 0", interval)
+	}
+
+	if resume {
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("cannot resume: no checkpoint %q", path)
+		}
+		if _, err := os.Stat(config.CSV); err != nil {
+			return fmt.Errorf("cannot resume: no output file %q", config.CSV)
+		}
+	} else if !utils.IsValidPath(path) {
+		return fmt.Errorf("invalid checkpoint file: %q", path)
+	}
+
+	config.Checkpoint = path
+	config.CheckpointInterval = interval
+	config.Resume = resume
+
+	return nil
+}
+
+// validateRate checks the query rate limit shared by all workers
+func validateRate(config *Config, rate float64, burst int, adaptive bool) error {
+	if rate < 0 {
+		return fmt.Errorf("invalid --rate %v: must not be negative", rate)
+	}
+
+	if burst < 0 {
+		return fmt.Errorf("invalid --burst %d: must not be negative", burst)
+	}
+
+	if rate == 0 && (burst > 0 || adaptive) {
+		return fmt.Errorf("--burst and --rate-adaptive require --rate")
+	}
+
+	config.Rate = rate
+	config.Burst = burst
+	config.AdaptiveRate = adaptive
+
+	return nil
+}
+
+// validateWorkers checks the number of workers, or its bounds when it is
+// tuned while scanning, the scan then starts with the minimum
+func validateWorkers(config *Config, auto bool, minWorkers, maxWorkers int) error {
+	if !auto {
+		if config.WORKERS < 1 {
+			return fmt.Errorf("invalid --workers %d: must be at least 1 or auto", config.WORKERS)
+		}
+		return nil
+	}
+
+	if minWorkers < 1 {
+		return fmt.Errorf("invalid --workers-min %d: must be at least 1", minWorkers)
+	}
+	if maxWorkers < minWorkers {
+		return fmt.Errorf("invalid --workers-max %d: must be at least --workers-min %d", maxWorkers, minWorkers)
+	}
+
+	config.WORKERS = minWorkers
+	config.WorkersMin = minWorkers
+	config.WorkersMax = maxWorkers
+
+	return nil
+}
+
+// validateResolvers checks the nameservers to query and normalizes them to host:port
+func validateResolvers(config *Config, resolvers []string, tcp bool) error {
+	if tcp && len(resolvers) == 0 {
+		return fmt.Errorf("--tcp requires at least one --resolver")
+	}
+
+	config.Resolvers = nil
+	for _, r := range resolvers {
+		server, err := resolver.ParseServer(r)
+		if err != nil {
+			return err
+		}
+		config.Resolvers = append(config.Resolvers, server)
+	}
+	config.TCP = tcp
+
+	return nil
+}
+
+// validateStrategy selects how the addresses of the IPv6 targets are
+// enumerated, IPv4 targets are always fully scanned
+func validateStrategy(config *Config, strategy string, lowByte int, hints string) error {
+	var v4, v6 utils.Ranges
+	for _, r := range config.Targets {
+		if r.Start.Is4() {
+			v4 = append(v4, r)
+		} else {
+			v6 = append(v6, r)
+		}
+	}
+
+	var v4Hosts utils.Generator = v4
+	if len(config.SkipLastBytes) > 0 {
+		v4Hosts = utils.NewLastByteFilter(v4, config.SkipLastBytes)
+	}
+
+	if len(v6) == 0 {
+		if strategy != StrategyFull {
+			return fmt.Errorf("--v6-strategy %q only applies to IPv6 ranges", strategy)
+		}
+		config.Hosts = v4Hosts
+		return nil
+	}
+
+	// sparse returns the addresses of an IPv6 range selected by the strategy,
+	// every address of the range when nil
+	var sparse func(r utils.Range) utils.Generator
+
+	switch strategy {
+	case StrategyFull:
+		if v6.Size() > utils.MaxFullScan {
+			return fmt.Errorf("IPv6 range %v is too large for a full scan, use --v6-strategy lowbyte, eui64 or seed", v6)
+		}
+
+	case StrategyLowByte:
+		if lowByte <= 0 {
+			return fmt.Errorf("invalid --v6-lowbyte %d: must be greater than 0", lowByte)
+		}
+		iids := utils.LowByteIIDs(lowByte)
+		sparse = func(r utils.Range) utils.Generator { return utils.NewSparse(r, iids) }
+
+	case StrategyEUI64:
+		lines, err := utils.ReadLines(hints)
+		if err != nil {
+			return fmt.Errorf("failed to read --v6-hints: %w", err)
+		}
+
+		iids := make([]uint64, 0, len(lines))
+		for _, line := range lines {
+			mac, err := net.ParseMAC(line)
+			if err != nil {
+				return fmt.Errorf("invalid MAC address %q in --v6-hints: %w", line, err)
+			}
+			iid, err := utils.EUI64IID(mac)
+			if err != nil {
+				return err
+			}
+			iids = append(iids, iid)
+		}
+		sparse = func(r utils.Range) utils.Generator { return utils.NewSparse(r, iids) }
+
+	case StrategySeed:
+		lines, err := utils.ReadLines(hints)
+		if err != nil {
+			return fmt.Errorf("failed to read --v6-hints: %w", err)
+		}
+
+		addrs := make([]netip.Addr, 0, len(lines))
+		for _, line := range lines {
+			addr, err := netip.ParseAddr(line)
+			if err != nil {
+				return fmt.Errorf("invalid IP %q in --v6-hints: %w", line, err)
+			}
+			addrs = append(addrs, addr)
+		}
+		sparse = func(r utils.Range) utils.Generator { return utils.NewSeeds(r, addrs) }
+
+	default:
+		return fmt.Errorf("invalid --v6-strategy %q: must be one of full, lowbyte, eui64, seed", strategy)
+	}
+
+	var hosts utils.Chain
+	if len(v4) > 0 {
+		hosts = append(hosts, v4Hosts)
+	}
+	if sparse == nil {
+		hosts = append(hosts, v6)
+	} else {
+		for _, r := range v6 {
+			hosts = append(hosts, sparse(r))
+		}
+	}
+
+	config.Hosts = hosts
+	if len(hosts) == 1 {
+		config.Hosts = hosts[0]
+	}
+	return nil
+}
+
+// validateSample keeps a sample of the hosts, either a share of them with
+// rate or perBlock addresses of every /24, drawn with the seed
+func validateSample(config *Config, rate float64, perBlock int, seed uint64) error {
+	if rate == 0 && perBlock == 0 {
+		return nil
+	}
+	if rate != 0 && perBlock != 0 {
+		return fmt.Errorf("cannot specify both --sample and --sample-per-24")
+	}
+
+	config.Population = config.Hosts.Size()
+	config.Seed = pickSeed(config, seed)
+
+	var err error
+	if rate != 0 {
+		config.SampleRate = rate
+		config.Hosts, err = utils.NewSample(config.Hosts, rate, config.Seed)
+		if err != nil {
+			return fmt.Errorf("invalid --sample: %w", err)
+		}
+		return nil
+	}
+
+	config.SamplePerBlock = perBlock
+	config.Hosts, err = utils.NewBlockSample(config.Hosts, perBlock, config.Seed)
+	if err != nil {
+		return fmt.Errorf("invalid --sample-per-24: %w", err)
+	}
+	return nil
+}
+
+// validateOrder shuffles the hosts when randomize is on, or keeps their
+// ascending order for a sorted output
+func validateOrder(config *Config, randomize, sorted bool, seed uint64) error {
+	if randomize && sorted {
+		return fmt.Errorf("cannot specify both --randomize and --sorted")
+	}
+	config.Sorted = sorted
+
+	if !randomize {
+		if seed != 0 && config.Seed == 0 {
+			return fmt.Errorf("--seed requires --randomize, --sample or --sample-per-24")
+		}
+		return nil
+	}
+
+	config.Seed = pickSeed(config, seed)
+
+	hosts, err := utils.NewPermutation(config.Hosts, config.Seed)
+	if err != nil {
+		return fmt.Errorf("invalid --randomize: %w", err)
+	}
+
+	config.Hosts = hosts
+	config.Randomize = true
+
+	return nil
+}
+
+// pickSeed returns the seed of the scan: the given one, the one already
+// picked, or a random one when both are zero
+func pickSeed(config *Config, seed uint64) uint64 {
+	if seed == 0 {
+		seed = config.Seed
+	}
+	for seed == 0 {
+		seed = rand.Uint64()
+	}
+	return seed
+}
+
+// validateShard keeps the slice of the hosts set by shard, N/M scans the
+// N-th of M slices. The shards of a randomized scan must share its seed.
+func validateShard(config *Config, shard string, seed uint64) error {
+	if shard == "" {
+		return nil
+	}
+
+	n, m, ok := strings.Cut(shard, "/")
+	index, err := strconv.ParseUint(strings.TrimSpace(n), 10, 64)
+	if !ok || err != nil {
+		return fmt.Errorf("invalid --shard %q: must be N/M", shard)
+	}
+	count, err := strconv.ParseUint(strings.TrimSpace(m), 10, 64)
+	if err != nil || index == 0 || index > count {
+		return fmt.Errorf("invalid --shard %q: must be N/M with N from 1 to M", shard)
+	}
+
+	if config.Seed != 0 && seed == 0 {
+		return fmt.Errorf("--shard with --randomize or a sample requires --seed, every shard must scan the same addresses in the same order")
+	}
+
+	hosts, err := utils.NewShard(config.Hosts, index-1, count)
+	if err != nil {
+		return fmt.Errorf("invalid --shard %q: %w", shard, err)
+	}
+
+	// a sampled shard stands for its slice of the population
+	if config.Population > 0 && hosts.Hosts.Size() > 0 {
+		hi, lo := bits.Mul64(config.Population, hosts.Size())
+		config.Population, _ = bits.Div64(hi, lo, hosts.Hosts.Size())
+	}
+
+	config.Hosts = hosts
+	config.Shard = index
+	config.Shards = count
+
+	return nil
 }
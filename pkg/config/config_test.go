@@ -3,9 +3,22 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/amine7536/reverse-scan/pkg/utils"
 )
 
+// cidrList returns the --cidr list of a single prefix, empty when cidr is
+func cidrList(cidr string) []string {
+	if cidr == "" {
+		return nil
+	}
+	return []string{cidr}
+}
+
 func TestValidateConfig(t *testing.T) {
 	// Create a temporary directory for testing
 	tmpDir := t.TempDir()
@@ -117,14 +130,23 @@ func TestValidateConfig(t *testing.T) {
 			wantErr: true,
 		},
 		{
-			name:    "invalid range - different first octet",
+			name:    "valid range - crossing /8 boundary",
+			start:   "9.255.255.0",
+			end:     "10.0.0.255",
+			cidr:    "",
+			output:  validOutputFile,
+			workers: 8,
+			wantErr: false,
+		},
+		{
+			name:    "invalid range - end in a lower /8 than start",
 			start:   "192.168.1.0",
 			end:     "10.168.1.255",
 			cidr:    "",
 			output:  validOutputFile,
 			workers: 8,
 			wantErr: true,
-			errMsg:  "invalid range: start and end IP must be in the same network",
+			errMsg:  "invalid range: end IP must be greater than start IP",
 		},
 		{
 			name:    "invalid range - end before start",
@@ -149,7 +171,7 @@ func TestValidateConfig(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			config, err := validateConfig(tt.start, tt.end, tt.cidr, tt.output, tt.workers)
+			config, err := validateConfig(tt.start, tt.end, cidrList(tt.cidr), nil, tt.output, tt.workers)
 
 			if (err != nil) != tt.wantErr {
 				t.Errorf("validateConfig() error = %v, wantErr %v", err, tt.wantErr)
@@ -210,7 +232,7 @@ func TestValidateConfigCIDRCalculation(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			config, err := validateConfig(tt.start, tt.end, "", validOutputFile, 8)
+			config, err := validateConfig(tt.start, tt.end, nil, nil, validOutputFile, 8)
 			if err != nil {
 				t.Fatalf("validateConfig() unexpected error = %v", err)
 			}
@@ -221,12 +243,78 @@ func TestValidateConfigCIDRCalculation(t *testing.T) {
 	}
 }
 
+func TestValidateConfigExactRange(t *testing.T) {
+	tmpDir := t.TempDir()
+	validOutputFile := filepath.Join(tmpDir, "output.csv")
+
+	tests := []struct {
+		name     string
+		start    string
+		end      string
+		cidr     string
+		wantSize uint64
+	}{
+		{
+			name:     "range inside a /23",
+			start:    "10.0.0.5",
+			end:      "10.0.1.20",
+			wantSize: 272,
+		},
+		{
+			name:     "range crossing /8 boundary",
+			start:    "9.255.255.250",
+			end:      "10.0.0.5",
+			wantSize: 12,
+		},
+		{
+			name:     "single address",
+			start:    "10.0.0.1",
+			end:      "10.0.0.1",
+			wantSize: 1,
+		},
+		{
+			name:     "CIDR /28",
+			cidr:     "10.0.0.0/28",
+			wantSize: 16,
+		},
+		{
+			name:     "IPv6 range",
+			start:    "2001:db8::fe",
+			end:      "2001:db8::201",
+			wantSize: 260,
+		},
+		{
+			name:     "IPv6 CIDR /120",
+			cidr:     "2001:db8::/120",
+			wantSize: 256,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := validateConfig(tt.start, tt.end, cidrList(tt.cidr), nil, validOutputFile, 8)
+			if err != nil {
+				t.Fatalf("validateConfig() unexpected error = %v", err)
+			}
+			if got := config.Targets.Size(); got != tt.wantSize {
+				t.Errorf("Config.Targets.Size() = %v, want %v", got, tt.wantSize)
+			}
+			if tt.cidr == "" && config.Targets[0].Start.String() != tt.start {
+				t.Errorf("Config.Targets[0].Start = %v, want %v", config.Targets[0].Start, tt.start)
+			}
+			if tt.cidr == "" && config.Targets[0].End.String() != tt.end {
+				t.Errorf("Config.Targets[0].End = %v, want %v", config.Targets[0].End, tt.end)
+			}
+		})
+	}
+}
+
 // TestConfigStruct verifies the Config struct fields
 func TestConfigStruct(t *testing.T) {
 	tmpDir := t.TempDir()
 	validOutputFile := filepath.Join(tmpDir, "output.csv")
 
-	config, err := validateConfig("192.168.1.0", "192.168.1.255", "", validOutputFile, 16)
+	config, err := validateConfig("192.168.1.0", "192.168.1.255", nil, nil, validOutputFile, 16)
 	if err != nil {
 		t.Fatalf("validateConfig() unexpected error = %v", err)
 	}
@@ -250,7 +338,7 @@ func TestValidateConfigFileCreation(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputFile := filepath.Join(tmpDir, "test-output.csv")
 
-	config, err := validateConfig("192.168.1.0", "192.168.1.10", "", outputFile, 8)
+	config, err := validateConfig("192.168.1.0", "192.168.1.10", nil, nil, outputFile, 8)
 	if err != nil {
 		t.Fatalf("validateConfig() unexpected error = %v", err)
 	}
@@ -310,7 +398,7 @@ func TestValidateConfigWithCIDR(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			config, err := validateConfig("", "", tt.cidr, validOutputFile, 8)
+			config, err := validateConfig("", "", cidrList(tt.cidr), nil, validOutputFile, 8)
 			if err != nil {
 				t.Fatalf("validateConfig() unexpected error = %v", err)
 			}
@@ -326,3 +414,1048 @@ func TestValidateConfigWithCIDR(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateStrategy(t *testing.T) {
+	tmpDir := t.TempDir()
+	validOutputFile := filepath.Join(tmpDir, "output.csv")
+
+	macs := filepath.Join(tmpDir, "macs.txt")
+	if err := os.WriteFile(macs, []byte("00:1a:2b:3c:4d:5e\n00:1a:2b:3c:4d:5f\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	seeds := filepath.Join(tmpDir, "seeds.txt")
+	if err := os.WriteFile(seeds, []byte("# known hosts\n2001:db8::1\n2001:db8:1::1\n2001:db9::1\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		cidr     string
+		strategy string
+		hints    string
+		lowByte  int
+		wantSize uint64
+		wantErr  bool
+	}{
+		{
+			name:     "IPv4 full",
+			cidr:     "10.0.0.0/24",
+			strategy: StrategyFull,
+			wantSize: 256,
+		},
+		{
+			name:     "IPv4 with sparse strategy",
+			cidr:     "10.0.0.0/24",
+			strategy: StrategyLowByte,
+			lowByte:  16,
+			wantErr:  true,
+		},
+		{
+			name:     "IPv6 full /64 is too large",
+			cidr:     "2001:db8::/64",
+			strategy: StrategyFull,
+			wantErr:  true,
+		},
+		{
+			name:     "IPv6 low-byte over a /56",
+			cidr:     "2001:db8::/56",
+			strategy: StrategyLowByte,
+			lowByte:  16,
+			wantSize: 256 * 16,
+		},
+		{
+			name:     "IPv6 low-byte of zero",
+			cidr:     "2001:db8::/56",
+			strategy: StrategyLowByte,
+			lowByte:  0,
+			wantErr:  true,
+		},
+		{
+			name:     "IPv6 EUI-64 hints over a /48",
+			cidr:     "2001:db8::/48",
+			strategy: StrategyEUI64,
+			hints:    macs,
+			wantSize: 65536 * 2,
+		},
+		{
+			name:     "IPv6 seeds inside the /32",
+			cidr:     "2001:db8::/32",
+			strategy: StrategySeed,
+			hints:    seeds,
+			wantSize: 2,
+		},
+		{
+			name:     "IPv6 seeds with invalid hints",
+			cidr:     "2001:db8::/32",
+			strategy: StrategySeed,
+			hints:    macs,
+			wantErr:  true,
+		},
+		{
+			name:     "unknown strategy",
+			cidr:     "2001:db8::/120",
+			strategy: "random",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := validateConfig("", "", cidrList(tt.cidr), nil, validOutputFile, 8)
+			if err != nil {
+				t.Fatalf("validateConfig() unexpected error = %v", err)
+			}
+
+			err = validateStrategy(config, tt.strategy, tt.lowByte, tt.hints)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateStrategy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := config.Hosts.Size(); got != tt.wantSize {
+				t.Errorf("Config.Hosts.Size() = %v, want %v", got, tt.wantSize)
+			}
+		})
+	}
+}
+
+func TestValidateResolvers(t *testing.T) {
+	tmpDir := t.TempDir()
+	validOutputFile := filepath.Join(tmpDir, "output.csv")
+
+	tests := []struct {
+		name      string
+		resolvers []string
+		want      []string
+		tcp       bool
+		wantErr   bool
+	}{
+		{
+			name: "system resolver",
+		},
+		{
+			name:      "default port",
+			resolvers: []string{"127.0.0.1", "[::1]:5353"},
+			want:      []string{"127.0.0.1:53", "[::1]:5353"},
+		},
+		{
+			name:      "TCP",
+			resolvers: []string{"127.0.0.1:53"},
+			want:      []string{"127.0.0.1:53"},
+			tcp:       true,
+		},
+		{
+			name:    "TCP without resolver",
+			tcp:     true,
+			wantErr: true,
+		},
+		{
+			name:      "hostname resolver",
+			resolvers: []string{"dns.example.com"},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := validateConfig("", "", []string{"10.0.0.0/24"}, nil, validOutputFile, 8)
+			if err != nil {
+				t.Fatalf("validateConfig() unexpected error = %v", err)
+			}
+
+			err = validateResolvers(config, tt.resolvers, tt.tcp)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateResolvers() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(config.Resolvers) != len(tt.want) {
+				t.Fatalf("Config.Resolvers = %v, want %v", config.Resolvers, tt.want)
+			}
+			for i := range tt.want {
+				if config.Resolvers[i] != tt.want[i] {
+					t.Errorf("Config.Resolvers[%d] = %v, want %v", i, config.Resolvers[i], tt.want[i])
+				}
+			}
+			if config.TCP != tt.tcp {
+				t.Errorf("Config.TCP = %v, want %v", config.TCP, tt.tcp)
+			}
+		})
+	}
+}
+
+func TestValidateLookup(t *testing.T) {
+	tests := []struct {
+		name        string
+		retryOn     []string
+		timeout     time.Duration
+		retryDelay  time.Duration
+		maxAttempts int
+		wantErr     bool
+	}{
+		{
+			name:        "valid settings",
+			timeout:     2 * time.Second,
+			maxAttempts: 3,
+			retryDelay:  100 * time.Millisecond,
+			retryOn:     []string{"timeout", "servfail"},
+		},
+		{
+			name:        "retries disabled",
+			timeout:     2 * time.Second,
+			maxAttempts: 1,
+		},
+		{
+			name:        "zero timeout",
+			timeout:     0,
+			maxAttempts: 1,
+			wantErr:     true,
+		},
+		{
+			name:        "negative timeout",
+			timeout:     -time.Second,
+			maxAttempts: 1,
+			wantErr:     true,
+		},
+		{
+			name:        "zero attempts",
+			timeout:     time.Second,
+			maxAttempts: 0,
+			wantErr:     true,
+		},
+		{
+			name:        "negative retry delay",
+			timeout:     time.Second,
+			maxAttempts: 3,
+			retryDelay:  -time.Second,
+			wantErr:     true,
+		},
+		{
+			name:        "retry on nxdomain",
+			timeout:     time.Second,
+			maxAttempts: 3,
+			retryOn:     []string{"nxdomain"},
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{}
+			err := validateLookup(config, tt.timeout, tt.maxAttempts, tt.retryDelay, tt.retryOn)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateLookup() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if config.Timeout != tt.timeout {
+				t.Errorf("Config.Timeout = %v, want %v", config.Timeout, tt.timeout)
+			}
+			if config.Retry.MaxAttempts != tt.maxAttempts {
+				t.Errorf("Config.Retry.MaxAttempts = %v, want %v", config.Retry.MaxAttempts, tt.maxAttempts)
+			}
+			if len(config.Retry.RetryOn) != len(tt.retryOn) {
+				t.Errorf("Config.Retry.RetryOn = %v, want %v", config.Retry.RetryOn, tt.retryOn)
+			}
+		})
+	}
+}
+
+func TestValidateWorkers(t *testing.T) {
+	tests := []struct {
+		name        string
+		workers     int
+		auto        bool
+		min         int
+		max         int
+		wantWorkers int
+		wantMax     int
+		wantErr     bool
+	}{
+		{
+			name:        "fixed",
+			workers:     16,
+			min:         8,
+			max:         512,
+			wantWorkers: 16,
+		},
+		{
+			name:    "no workers",
+			workers: 0,
+			wantErr: true,
+		},
+		{
+			name:        "auto starts at the minimum",
+			workers:     16,
+			auto:        true,
+			min:         4,
+			max:         64,
+			wantWorkers: 4,
+			wantMax:     64,
+		},
+		{
+			name:    "auto without a minimum",
+			auto:    true,
+			max:     64,
+			wantErr: true,
+		},
+		{
+			name:    "auto with a maximum below the minimum",
+			auto:    true,
+			min:     64,
+			max:     4,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{WORKERS: tt.workers}
+			err := validateWorkers(config, tt.auto, tt.min, tt.max)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateWorkers() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if config.WORKERS != tt.wantWorkers || config.WorkersMax != tt.wantMax {
+				t.Errorf("Config workers = %v up to %v, want %v up to %v", config.WORKERS, config.WorkersMax, tt.wantWorkers, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestValidateRate(t *testing.T) {
+	tests := []struct {
+		name     string
+		rate     float64
+		burst    int
+		adaptive bool
+		wantErr  bool
+	}{
+		{
+			name: "no limit",
+		},
+		{
+			name:     "rate with burst",
+			rate:     500,
+			burst:    50,
+			adaptive: true,
+		},
+		{
+			name:    "negative rate",
+			rate:    -1,
+			wantErr: true,
+		},
+		{
+			name:    "negative burst",
+			rate:    10,
+			burst:   -1,
+			wantErr: true,
+		},
+		{
+			name:    "burst without rate",
+			burst:   10,
+			wantErr: true,
+		},
+		{
+			name:     "adaptive without rate",
+			adaptive: true,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{}
+			err := validateRate(config, tt.rate, tt.burst, tt.adaptive)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateRate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if config.Rate != tt.rate || config.Burst != tt.burst || config.AdaptiveRate != tt.adaptive {
+				t.Errorf("Config rate = %v/%v/%v, want %v/%v/%v", config.Rate, config.Burst, config.AdaptiveRate, tt.rate, tt.burst, tt.adaptive)
+			}
+		})
+	}
+}
+
+func TestValidateCheckpoint(t *testing.T) {
+	tmpDir := t.TempDir()
+	output := filepath.Join(tmpDir, "output.csv")
+	existing := filepath.Join(tmpDir, "existing.checkpoint")
+	if err := os.WriteFile(existing, []byte("{}"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		want     string
+		interval time.Duration
+		resume   bool
+		output   bool
+		wantErr  bool
+	}{
+		{
+			name:     "default path",
+			interval: time.Second,
+			want:     output + ".checkpoint",
+		},
+		{
+			name:     "explicit path",
+			path:     filepath.Join(tmpDir, "scan.checkpoint"),
+			interval: time.Second,
+			want:     filepath.Join(tmpDir, "scan.checkpoint"),
+		},
+		{
+			name:     "invalid path",
+			path:     "/nonexistent/directory/scan.checkpoint",
+			interval: time.Second,
+			wantErr:  true,
+		},
+		{
+			name:     "zero interval",
+			interval: 0,
+			wantErr:  true,
+		},
+		{
+			name:     "resume",
+			path:     existing,
+			interval: time.Second,
+			resume:   true,
+			output:   true,
+			want:     existing,
+		},
+		{
+			name:     "resume without checkpoint",
+			interval: time.Second,
+			resume:   true,
+			output:   true,
+			wantErr:  true,
+		},
+		{
+			name:     "resume without output",
+			path:     existing,
+			interval: time.Second,
+			resume:   true,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.output {
+				if err := os.WriteFile(output, nil, 0644); err != nil {
+					t.Fatalf("Failed to create test file: %v", err)
+				}
+				defer os.Remove(output) //nolint:errcheck
+			}
+
+			config := &Config{CSV: output}
+			err := validateCheckpoint(config, tt.path, tt.interval, tt.resume)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateCheckpoint() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if config.Checkpoint != tt.want {
+				t.Errorf("Config.Checkpoint = %v, want %v", config.Checkpoint, tt.want)
+			}
+			if config.Resume != tt.resume {
+				t.Errorf("Config.Resume = %v, want %v", config.Resume, tt.resume)
+			}
+		})
+	}
+}
+
+func TestValidateFormat(t *testing.T) {
+	tests := []struct {
+		format  string
+		wantErr bool
+	}{
+		{format: DefaultFormat},
+		{format: "jsonl"},
+		// formats registered by library users are checked by the scanner
+		{format: "custom"},
+		{format: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			config := &Config{}
+			err := validateFormat(config, tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateFormat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && config.Format != tt.format {
+				t.Errorf("Config.Format = %v, want %v", config.Format, tt.format)
+			}
+		})
+	}
+}
+
+func TestValidateConfigTargets(t *testing.T) {
+	validOutputFile := filepath.Join(t.TempDir(), "output.csv")
+
+	tests := []struct {
+		name        string
+		start       string
+		cidrs       []string
+		targets     []string
+		wantRanges  string
+		wantCIDR    string
+		wantSize    uint64
+		wantTargets int
+		wantErr     bool
+	}{
+		{
+			name:        "repeated CIDRs",
+			cidrs:       []string{"10.0.0.0/24", "10.0.2.0/24"},
+			wantRanges:  "10.0.0.0-10.0.0.255,10.0.2.0-10.0.2.255",
+			wantSize:    512,
+			wantTargets: 2,
+		},
+		{
+			name:        "overlapping CIDRs and targets",
+			cidrs:       []string{"10.0.0.0/24"},
+			targets:     []string{"10.0.0.200-10.0.1.5", "10.0.0.1", "10.0.1.0/30"},
+			wantRanges:  "10.0.0.0-10.0.1.5",
+			wantCIDR:    "10.0.0.0/23",
+			wantSize:    262,
+			wantTargets: 4,
+		},
+		{
+			name:        "single CIDR keeps its notation",
+			cidrs:       []string{"10.0.0.0/24"},
+			wantRanges:  "10.0.0.0-10.0.0.255",
+			wantCIDR:    "10.0.0.0/24",
+			wantSize:    256,
+			wantTargets: 1,
+		},
+		{
+			name:        "targets only",
+			targets:     []string{"192.0.2.1", "2001:db8::1-2001:db8::4"},
+			wantRanges:  "192.0.2.1-192.0.2.1,2001:db8::1-2001:db8::4",
+			wantSize:    5,
+			wantTargets: 2,
+		},
+		{
+			name:    "invalid CIDR",
+			cidrs:   []string{"10.0.0.0/24", "10.0.0.1-10.0.0.5"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid target",
+			targets: []string{"not-a-target"},
+			wantErr: true,
+		},
+		{
+			name:    "targets with a start range",
+			start:   "10.0.0.1",
+			targets: []string{"10.0.0.0/24"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := validateConfig(tt.start, "", tt.cidrs, tt.targets, validOutputFile, 8)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if got := config.Targets.String(); got != tt.wantRanges {
+				t.Errorf("Config.Targets = %v, want %v", got, tt.wantRanges)
+			}
+			if got := config.Hosts.Size(); got != tt.wantSize {
+				t.Errorf("Config.Hosts.Size() = %v, want %v", got, tt.wantSize)
+			}
+			if config.TargetCount != tt.wantTargets {
+				t.Errorf("Config.TargetCount = %v, want %v", config.TargetCount, tt.wantTargets)
+			}
+			if config.CIDR != tt.wantCIDR {
+				t.Errorf("Config.CIDR = %v, want %v", config.CIDR, tt.wantCIDR)
+			}
+		})
+	}
+}
+
+func TestReadTargets(t *testing.T) {
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "targets.txt")
+	if err := os.WriteFile(file, []byte("# office\n10.0.0.0/24\n\n10.0.1.1 # printer\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	empty := filepath.Join(tmpDir, "empty.txt")
+	if err := os.WriteFile(empty, []byte("# nothing yet\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		stdin   string
+		want    []string
+		wantErr bool
+	}{
+		{name: "no file", path: ""},
+		{name: "file", path: file, want: []string{"10.0.0.0/24", "10.0.1.1"}},
+		{name: "stdin", path: "-", stdin: "192.0.2.0/28\n192.0.2.100\n", want: []string{"192.0.2.0/28", "192.0.2.100"}},
+		{name: "empty file", path: empty, wantErr: true},
+		{name: "missing file", path: filepath.Join(tmpDir, "missing.txt"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readTargets(tt.path, strings.NewReader(tt.stdin))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readTargets() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("readTargets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateStrategyMixedTargets(t *testing.T) {
+	validOutputFile := filepath.Join(t.TempDir(), "output.csv")
+
+	config, err := validateConfig("", "", []string{"10.0.0.0/30", "2001:db8::/56", "2001:db8:1::/64"}, nil, validOutputFile, 8)
+	if err != nil {
+		t.Fatalf("validateConfig() unexpected error = %v", err)
+	}
+
+	if err := validateStrategy(config, StrategyFull, 0, ""); err == nil {
+		t.Error("validateStrategy() should reject a full scan of the IPv6 targets")
+	}
+
+	if err := validateStrategy(config, StrategyLowByte, 4, ""); err != nil {
+		t.Fatalf("validateStrategy() unexpected error = %v", err)
+	}
+	// every IPv4 address plus 4 addresses in each of the 257 /64s
+	if got, want := config.Hosts.Size(), uint64(4+257*4); got != want {
+		t.Errorf("Config.Hosts.Size() = %v, want %v", got, want)
+	}
+}
+
+func TestValidateExclude(t *testing.T) {
+	tmpDir := t.TempDir()
+	validOutputFile := filepath.Join(tmpDir, "output.csv")
+
+	file := filepath.Join(tmpDir, "exclude.txt")
+	if err := os.WriteFile(file, []byte("# honeypot\n10.0.1.0/25\n10.0.2.10-10.0.2.19 # customer\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		exclude      []string
+		file         string
+		wantTargets  string
+		wantExcluded uint64
+		wantErr      bool
+	}{
+		{
+			name:        "no exclusion",
+			wantTargets: "10.0.0.0-10.0.3.255",
+		},
+		{
+			name:         "flags",
+			exclude:      []string{"10.0.0.0/24", "10.0.3.255"},
+			wantTargets:  "10.0.1.0-10.0.3.254",
+			wantExcluded: 257,
+		},
+		{
+			name:         "file and flags",
+			exclude:      []string{"10.0.0.0/24"},
+			file:         file,
+			wantTargets:  "10.0.1.128-10.0.2.9,10.0.2.20-10.0.3.255",
+			wantExcluded: 256 + 128 + 10,
+		},
+		{
+			name:        "outside the targets",
+			exclude:     []string{"192.0.2.0/24"},
+			wantTargets: "10.0.0.0-10.0.3.255",
+		},
+		{
+			name:    "everything",
+			exclude: []string{"10.0.0.0/16"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid entry",
+			exclude: []string{"10.0.0.0/99"},
+			wantErr: true,
+		},
+		{
+			name:    "missing file",
+			file:    filepath.Join(tmpDir, "missing.txt"),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := validateConfig("", "", []string{"10.0.0.0/22"}, nil, validOutputFile, 8)
+			if err != nil {
+				t.Fatalf("validateConfig() unexpected error = %v", err)
+			}
+
+			err = validateExclude(config, tt.exclude, tt.file)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateExclude() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if got := config.Targets.String(); got != tt.wantTargets {
+				t.Errorf("Config.Targets = %v, want %v", got, tt.wantTargets)
+			}
+			if config.Excluded != tt.wantExcluded {
+				t.Errorf("Config.Excluded = %v, want %v", config.Excluded, tt.wantExcluded)
+			}
+			if got, want := config.Hosts.Size(), 1024-tt.wantExcluded; got != want {
+				t.Errorf("Config.Hosts.Size() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestValidateSkip(t *testing.T) {
+	validOutputFile := filepath.Join(t.TempDir(), "output.csv")
+
+	tests := []struct {
+		name             string
+		cidrs            []string
+		targets          []string
+		networkBroadcast bool
+		patterns         []string
+		wantSkipped      uint64
+		wantSize         uint64
+		wantErr          bool
+	}{
+		{
+			name:             "network and broadcast of a /24",
+			cidrs:            []string{"10.0.0.0/24"},
+			networkBroadcast: true,
+			wantSkipped:      2,
+			wantSize:         254,
+		},
+		{
+			name:             "every CIDR target",
+			cidrs:            []string{"10.0.0.0/24", "10.0.1.0/24"},
+			targets:          []string{"10.0.2.0/30", "10.0.3.0-10.0.3.255"},
+			networkBroadcast: true,
+			// the 10.0.3.0-10.0.3.255 range is not a prefix
+			wantSkipped: 6,
+			wantSize:    512 + 4 + 256 - 6,
+		},
+		{
+			name:             "/31 and /32 keep their addresses",
+			cidrs:            []string{"10.0.0.0/31", "10.0.0.9/32"},
+			networkBroadcast: true,
+			wantSize:         3,
+		},
+		{
+			name:             "IPv6 has no broadcast",
+			cidrs:            []string{"2001:db8::/120"},
+			networkBroadcast: true,
+			wantSize:         256,
+		},
+		{
+			name:     "pattern over a classful block",
+			cidrs:    []string{"10.0.0.0/16"},
+			patterns: []string{".0", "255"},
+			wantSize: 256 * 254,
+		},
+		{
+			name:     "pattern range",
+			cidrs:    []string{"10.0.0.0/24"},
+			patterns: []string{".250-.255"},
+			wantSize: 250,
+		},
+		{
+			name:     "pattern out of bounds",
+			cidrs:    []string{"10.0.0.0/24"},
+			patterns: []string{"256"},
+			wantErr:  true,
+		},
+		{
+			name:     "pattern range reversed",
+			cidrs:    []string{"10.0.0.0/24"},
+			patterns: []string{".255-.250"},
+			wantErr:  true,
+		},
+		{
+			name:     "pattern on IPv6 targets",
+			cidrs:    []string{"2001:db8::/120"},
+			patterns: []string{".0"},
+			wantErr:  true,
+		},
+		{
+			name:             "network and broadcast given as addresses",
+			targets:          []string{"10.0.0.0", "10.0.0.3", "10.0.0.0/30"},
+			cidrs:            []string{"10.0.0.0/30"},
+			networkBroadcast: true,
+			wantSize:         4,
+		},
+		{
+			name:             "prefix inside a wider CIDR",
+			cidrs:            []string{"10.0.0.0/16"},
+			targets:          []string{"10.0.1.0/24"},
+			networkBroadcast: true,
+			// 10.0.1.0 and 10.0.1.255 are hosts of the /16
+			wantSkipped: 2,
+			wantSize:    65536 - 2,
+		},
+		{
+			name:             "overlapping ranges",
+			cidrs:            []string{"10.0.0.0/24", "10.0.1.0/24"},
+			targets:          []string{"10.0.0.200-10.0.1.10"},
+			networkBroadcast: true,
+			wantSkipped:      2,
+			wantSize:         512 - 2,
+		},
+		{
+			name:             "adjacent prefixes keep their edges out",
+			cidrs:            []string{"10.0.0.0/25", "10.0.0.128/25"},
+			networkBroadcast: true,
+			wantSkipped:      4,
+			wantSize:         256 - 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := validateConfig("", "", tt.cidrs, tt.targets, validOutputFile, 8)
+			if err != nil {
+				t.Fatalf("validateConfig() unexpected error = %v", err)
+			}
+
+			err = validateSkip(config, tt.networkBroadcast, tt.patterns)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateSkip() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if err := validateStrategy(config, StrategyFull, 0, ""); err != nil {
+				t.Fatalf("validateStrategy() unexpected error = %v", err)
+			}
+			if config.Skipped != tt.wantSkipped {
+				t.Errorf("Config.Skipped = %v, want %v", config.Skipped, tt.wantSkipped)
+			}
+			if got := config.Hosts.Size(); got != tt.wantSize {
+				t.Errorf("Config.Hosts.Size() = %v, want %v", got, tt.wantSize)
+			}
+		})
+	}
+}
+
+func TestValidateOrder(t *testing.T) {
+	validOutputFile := filepath.Join(t.TempDir(), "output.csv")
+
+	tests := []struct {
+		name      string
+		randomize bool
+		sorted    bool
+		seed      uint64
+		wantSeed  uint64
+		wantErr   bool
+	}{
+		{name: "ascending order"},
+		{name: "sorted", sorted: true},
+		{name: "randomized and sorted", randomize: true, sorted: true, wantErr: true},
+		{name: "seed without randomize", seed: 7, wantErr: true},
+		{name: "given seed", randomize: true, seed: 7, wantSeed: 7},
+		{name: "random seed", randomize: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := validateConfig("", "", []string{"10.0.0.0/24", "2001:db8::/120"}, nil, validOutputFile, 8)
+			if err != nil {
+				t.Fatalf("validateConfig() unexpected error = %v", err)
+			}
+			if err := validateStrategy(config, StrategyFull, 0, ""); err != nil {
+				t.Fatalf("validateStrategy() unexpected error = %v", err)
+			}
+
+			err = validateOrder(config, tt.randomize, tt.sorted, tt.seed)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateOrder() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if got := config.Hosts.Size(); got != 512 {
+				t.Errorf("Config.Hosts.Size() = %v, want 512", got)
+			}
+			if !tt.randomize {
+				if _, ok := config.Hosts.(utils.Permutation); ok {
+					t.Errorf("Config.Hosts = %T, want the ascending order", config.Hosts)
+				}
+				return
+			}
+
+			p, ok := config.Hosts.(utils.Permutation)
+			if !ok {
+				t.Fatalf("Config.Hosts = %T, want utils.Permutation", config.Hosts)
+			}
+			if p.Seed == 0 || p.Seed != config.Seed {
+				t.Errorf("Permutation.Seed = %v, Config.Seed = %v", p.Seed, config.Seed)
+			}
+			if tt.wantSeed != 0 && config.Seed != tt.wantSeed {
+				t.Errorf("Config.Seed = %v, want %v", config.Seed, tt.wantSeed)
+			}
+		})
+	}
+}
+
+func TestValidateShard(t *testing.T) {
+	validOutputFile := filepath.Join(t.TempDir(), "output.csv")
+
+	tests := []struct {
+		name      string
+		shard     string
+		randomize bool
+		seed      uint64
+		wantSize  uint64
+		wantErr   bool
+	}{
+		{name: "not sharded", wantSize: 256},
+		{name: "first of four", shard: "1/4", wantSize: 64},
+		{name: "last of three", shard: "3/3", wantSize: 86},
+		{name: "spaces", shard: " 2 / 3 ", wantSize: 85},
+		{name: "randomized with a seed", shard: "2/2", randomize: true, seed: 9, wantSize: 128},
+		{name: "randomized without a seed", shard: "2/2", randomize: true, wantErr: true},
+		{name: "zero based", shard: "0/4", wantErr: true},
+		{name: "past the last", shard: "5/4", wantErr: true},
+		{name: "no shards", shard: "0/0", wantErr: true},
+		{name: "missing count", shard: "1", wantErr: true},
+		{name: "not a number", shard: "a/b", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := validateConfig("", "", []string{"10.0.0.0/24"}, nil, validOutputFile, 8)
+			if err != nil {
+				t.Fatalf("validateConfig() unexpected error = %v", err)
+			}
+			if err := validateStrategy(config, StrategyFull, 0, ""); err != nil {
+				t.Fatalf("validateStrategy() unexpected error = %v", err)
+			}
+			if err := validateOrder(config, tt.randomize, false, tt.seed); err != nil {
+				t.Fatalf("validateOrder() unexpected error = %v", err)
+			}
+
+			err = validateShard(config, tt.shard, tt.seed)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateShard() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if got := config.Hosts.Size(); got != tt.wantSize {
+				t.Errorf("Config.Hosts.Size() = %v, want %v", got, tt.wantSize)
+			}
+		})
+	}
+}
+
+func TestValidateSample(t *testing.T) {
+	validOutputFile := filepath.Join(t.TempDir(), "output.csv")
+
+	tests := []struct {
+		name     string
+		cidrs    []string
+		rate     float64
+		perBlock int
+		seed     uint64
+		wantSize uint64
+		wantErr  bool
+	}{
+		{name: "not sampled", cidrs: []string{"10.0.0.0/16"}, wantSize: 65536},
+		{name: "share", cidrs: []string{"10.0.0.0/16"}, rate: 0.01, wantSize: 656},
+		{name: "per /24", cidrs: []string{"10.0.0.0/16"}, perBlock: 4, wantSize: 1024},
+		{name: "per /24 of a small range", cidrs: []string{"10.0.0.0/30"}, perBlock: 8, wantSize: 4},
+		{name: "share of IPv6", cidrs: []string{"2001:db8::/120"}, rate: 0.5, wantSize: 128},
+		{name: "per /24 of IPv6", cidrs: []string{"2001:db8::/120"}, perBlock: 4, wantErr: true},
+		{name: "both", cidrs: []string{"10.0.0.0/16"}, rate: 0.01, perBlock: 4, wantErr: true},
+		{name: "share above 1", cidrs: []string{"10.0.0.0/16"}, rate: 1.5, wantErr: true},
+		{name: "negative share", cidrs: []string{"10.0.0.0/16"}, rate: -0.1, wantErr: true},
+		{name: "too many per /24", cidrs: []string{"10.0.0.0/16"}, perBlock: 300, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := validateConfig("", "", tt.cidrs, nil, validOutputFile, 8)
+			if err != nil {
+				t.Fatalf("validateConfig() unexpected error = %v", err)
+			}
+			if err := validateStrategy(config, StrategyFull, 0, ""); err != nil {
+				t.Fatalf("validateStrategy() unexpected error = %v", err)
+			}
+
+			err = validateSample(config, tt.rate, tt.perBlock, tt.seed)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateSample() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if got := config.Hosts.Size(); got != tt.wantSize {
+				t.Errorf("Config.Hosts.Size() = %v, want %v", got, tt.wantSize)
+			}
+			sampled := tt.rate != 0 || tt.perBlock != 0
+			if sampled != (config.Population > 0) || sampled != (config.Seed != 0) {
+				t.Errorf("Config.Population = %v, Config.Seed = %v, sampled %v", config.Population, config.Seed, sampled)
+			}
+		})
+	}
+}
+
+func TestNewSampledShards(t *testing.T) {
+	o := DefaultOptions()
+	o.CIDRs = []string{"10.0.0.0/16"}
+	o.Output = filepath.Join(t.TempDir(), "output.csv")
+	o.SamplePer24 = 2
+	o.Randomize = true
+	o.Shard = "1/4"
+
+	if _, err := New(o); err == nil {
+		t.Errorf("New() of a sampled shard without --seed expected error")
+	}
+
+	o.Seed = 5
+	c, err := New(o)
+	if err != nil {
+		t.Fatalf("New() unexpected error = %v", err)
+	}
+	if c.Hosts.Size() != 128 || c.Population != 16384 {
+		t.Errorf("New() scans %v IPs standing for %v, want 128 for 16384", c.Hosts.Size(), c.Population)
+	}
+
+	// the seed alone is only for randomized or sampled scans
+	o.Randomize, o.SamplePer24, o.Shard = false, 0, ""
+	if _, err := New(o); err == nil {
+		t.Errorf("New() with --seed alone expected error")
+	}
+}
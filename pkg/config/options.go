@@ -0,0 +1,272 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/amine7536/reverse-scan/pkg/resolver"
+)
+
+// EnvPrefix prefixes the environment variables of the settings, the
+// variable of v6-strategy is REVERSE_SCAN_V6_STRATEGY
+const EnvPrefix = "REVERSE_SCAN_"
+
+// Options are the settings of a scan before validation, each one is named
+// after its command line flag
+type Options struct {
+	// Stdin is read for the targets of the - file, os.Stdin when nil
+	Stdin      io.Reader
+	Start      string
+	End        string
+	Output     string
+	Format     string
+	Checkpoint string
+	V6Strategy string
+	V6Hints    string
+	// Shard is the N/M slice of the addresses to scan
+	Shard string
+	// Targets is a file of targets, - reads them from Stdin
+	Targets string
+	// ExcludeFile is a file of ranges never to query
+	ExcludeFile string
+	CIDRs       []string
+	Exclude     []string
+	SkipPattern []string
+	Resolvers   []string
+	RetryOn     []string
+	// CheckpointInterval is the time between two checkpoints
+	CheckpointInterval time.Duration
+	Timeout            time.Duration
+	RetryDelay         time.Duration
+	Rate               float64
+	// Sample is the share of the addresses to scan
+	Sample float64
+	// Seed sets the order of a randomized scan and the addresses sampled, random when zero
+	Seed        uint64
+	Workers     int
+	WorkersMin  int
+	WorkersMax  int
+	Burst       int
+	MaxAttempts int
+	V6LowByte   int
+	SamplePer24 int
+	// WorkersAuto tunes the number of workers between WorkersMin and WorkersMax
+	WorkersAuto  bool
+	Resume       bool
+	TCP          bool
+	RateAdaptive bool
+	Randomize    bool
+	Sorted       bool
+	// SkipNetworkBroadcast drops the network and broadcast addresses of the IPv4 CIDR targets
+	SkipNetworkBroadcast bool
+}
+
+// Keys are the names of the settings
+var Keys = []string{
+	"start", "end", "cidr", "targets", "exclude", "exclude-file",
+	"skip-network-broadcast", "skip-pattern", "randomize", "seed", "shard",
+	"sample", "sample-per-24",
+	"output", "format", "sorted", "workers", "workers-min", "workers-max",
+	"resume", "checkpoint", "checkpoint-interval",
+	"resolver", "tcp", "timeout",
+	"rate", "burst", "rate-adaptive",
+	"max-attempts", "retry-delay", "retry-on",
+	"v6-strategy", "v6-lowbyte", "v6-hints",
+}
+
+// DefaultOptions returns the settings used when no source sets them
+func DefaultOptions() Options {
+	return Options{
+		Format:             DefaultFormat,
+		Workers:            8,
+		WorkersMin:         8,
+		WorkersMax:         512,
+		CheckpointInterval: 10 * time.Second,
+		Timeout:            resolver.DefaultTimeout,
+		MaxAttempts:        resolver.DefaultMaxAttempts,
+		RetryDelay:         resolver.DefaultRetryDelay,
+		RetryOn:            []string{string(resolver.StatusTimeout), string(resolver.StatusServFail)},
+		V6Strategy:         StrategyFull,
+		V6LowByte:          256,
+	}
+}
+
+// Set parses value into the setting named key, lists are comma separated
+func (o *Options) Set(key, value string) error {
+	var err error
+	switch key {
+	case "start":
+		o.Start = value
+	case "end":
+		o.End = value
+	case "cidr":
+		o.CIDRs = splitList(value)
+	case "targets":
+		o.Targets = value
+	case "exclude":
+		o.Exclude = splitList(value)
+	case "exclude-file":
+		o.ExcludeFile = value
+	case "skip-network-broadcast":
+		o.SkipNetworkBroadcast, err = strconv.ParseBool(value)
+	case "skip-pattern":
+		o.SkipPattern = splitList(value)
+	case "randomize":
+		o.Randomize, err = strconv.ParseBool(value)
+	case "seed":
+		o.Seed, err = strconv.ParseUint(value, 10, 64)
+	case "shard":
+		o.Shard = value
+	case "sample":
+		o.Sample, err = strconv.ParseFloat(value, 64)
+	case "sample-per-24":
+		o.SamplePer24, err = strconv.Atoi(value)
+	case "output":
+		o.Output = value
+	case "format":
+		o.Format = value
+	case "sorted":
+		o.Sorted, err = strconv.ParseBool(value)
+	case "workers":
+		o.WorkersAuto = value == "auto"
+		if !o.WorkersAuto {
+			o.Workers, err = strconv.Atoi(value)
+		}
+	case "workers-min":
+		o.WorkersMin, err = strconv.Atoi(value)
+	case "workers-max":
+		o.WorkersMax, err = strconv.Atoi(value)
+	case "resume":
+		o.Resume, err = strconv.ParseBool(value)
+	case "checkpoint":
+		o.Checkpoint = value
+	case "checkpoint-interval":
+		o.CheckpointInterval, err = time.ParseDuration(value)
+	case "resolver":
+		o.Resolvers = splitList(value)
+	case "tcp":
+		o.TCP, err = strconv.ParseBool(value)
+	case "timeout":
+		o.Timeout, err = time.ParseDuration(value)
+	case "rate":
+		o.Rate, err = strconv.ParseFloat(value, 64)
+	case "burst":
+		o.Burst, err = strconv.Atoi(value)
+	case "rate-adaptive":
+		o.RateAdaptive, err = strconv.ParseBool(value)
+	case "max-attempts":
+		o.MaxAttempts, err = strconv.Atoi(value)
+	case "retry-delay":
+		o.RetryDelay, err = time.ParseDuration(value)
+	case "retry-on":
+		o.RetryOn = splitList(value)
+	case "v6-strategy":
+		o.V6Strategy = value
+	case "v6-lowbyte":
+		o.V6LowByte, err = strconv.Atoi(value)
+	case "v6-hints":
+		o.V6Hints = value
+	default:
+		return fmt.Errorf("unknown setting %q", key)
+	}
+
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: %w", key, value, err)
+	}
+	return nil
+}
+
+// LoadFile sets the settings of a JSON or TOML file, the format is chosen
+// by the file extension
+func (o *Options) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	settings := make(map[string]any)
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		// keep numbers as written, 1e3 is not a valid number of workers
+		dec.UseNumber()
+		err = dec.Decode(&settings)
+	case ".toml":
+		err = toml.Unmarshal(data, &settings)
+	default:
+		return fmt.Errorf("invalid config file %q: unknown extension %q, must be .json or .toml", path, ext)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid config file %q: %w", path, err)
+	}
+
+	for _, key := range Keys {
+		v, ok := settings[key]
+		if !ok {
+			continue
+		}
+		if err := o.Set(key, fileValue(v)); err != nil {
+			return fmt.Errorf("invalid config file %q: %w", path, err)
+		}
+		delete(settings, key)
+	}
+
+	for key := range settings {
+		return fmt.Errorf("invalid config file %q: unknown setting %q", path, key)
+	}
+	return nil
+}
+
+// LoadEnv sets the settings found in the environment, lookup is usually os.LookupEnv
+func (o *Options) LoadEnv(lookup func(string) (string, bool)) error {
+	for _, key := range Keys {
+		name := EnvName(key)
+		value, ok := lookup(name)
+		if !ok {
+			continue
+		}
+		if err := o.Set(key, value); err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// EnvName returns the environment variable of the setting key
+func EnvName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+}
+
+// fileValue formats a value decoded from a config file the way Set parses it
+func fileValue(v any) string {
+	list, ok := v.([]any)
+	if !ok {
+		return fmt.Sprint(v)
+	}
+
+	items := make([]string, 0, len(list))
+	for _, item := range list {
+		items = append(items, fmt.Sprint(item))
+	}
+	return strings.Join(items, ",")
+}
+
+// splitList splits a comma separated list, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,227 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOptionsSet(t *testing.T) {
+	tests := []struct {
+		key     string
+		value   string
+		wantErr bool
+	}{
+		{key: "workers", value: "16"},
+		{key: "workers", value: "many", wantErr: true},
+		{key: "workers", value: "auto"},
+		{key: "resume", value: "true"},
+		{key: "resume", value: "maybe", wantErr: true},
+		{key: "timeout", value: "2s"},
+		{key: "timeout", value: "2", wantErr: true},
+		{key: "rate", value: "100.5"},
+		{key: "rate", value: "fast", wantErr: true},
+		{key: "resolver", value: "192.0.2.53, 192.0.2.54:5353"},
+		{key: "unknown", value: "1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key+"="+tt.value, func(t *testing.T) {
+			o := DefaultOptions()
+			err := o.Set(tt.key, tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Options.Set() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOptionsSetEveryKey(t *testing.T) {
+	values := map[string]string{
+		"workers": "1", "workers-min": "1", "workers-max": "2", "resume": "true", "checkpoint-interval": "1s", "tcp": "true",
+		"timeout": "1s", "rate": "1", "burst": "1", "rate-adaptive": "true",
+		"max-attempts": "1", "retry-delay": "1s", "v6-lowbyte": "1", "skip-network-broadcast": "true",
+		"randomize": "true", "seed": "7", "sample": "0.5", "sample-per-24": "4", "sorted": "true",
+	}
+
+	for _, key := range Keys {
+		o := DefaultOptions()
+		value, ok := values[key]
+		if !ok {
+			value = "value"
+		}
+		if err := o.Set(key, value); err != nil {
+			t.Errorf("Options.Set(%q) error = %v", key, err)
+		}
+	}
+}
+
+func TestOptionsSetLists(t *testing.T) {
+	o := DefaultOptions()
+	if err := o.Set("retry-on", "timeout, refused,"); err != nil {
+		t.Fatalf("Options.Set() unexpected error = %v", err)
+	}
+	if want := []string{"timeout", "refused"}; !slices.Equal(o.RetryOn, want) {
+		t.Errorf("Options.RetryOn = %v, want %v", o.RetryOn, want)
+	}
+}
+
+func TestOptionsLoadFile(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		wantErr bool
+	}{
+		{
+			name: "json",
+			file: "scan.json",
+			content: `{"cidr": "192.0.2.0/24", "workers": 16, "timeout": "2s", "rate-adaptive": true,
+				"rate": 50, "resolver": ["192.0.2.53", "192.0.2.54"]}`,
+		},
+		{
+			name: "toml",
+			file: "scan.toml",
+			content: `cidr = "192.0.2.0/24"
+workers = 16
+timeout = "2s"
+rate-adaptive = true
+rate = 50.0
+resolver = ["192.0.2.53", "192.0.2.54"]
+`,
+		},
+		{name: "unknown setting", file: "bad.json", content: `{"wrokers": 16}`, wantErr: true},
+		{name: "invalid value", file: "bad.toml", content: `workers = "many"`, wantErr: true},
+		{name: "invalid syntax", file: "broken.json", content: `{"workers":`, wantErr: true},
+		{name: "unknown extension", file: "scan.yaml", content: `workers: 16`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(tmpDir, tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			o := DefaultOptions()
+			err := o.LoadFile(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Options.LoadFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if !slices.Equal(o.CIDRs, []string{"192.0.2.0/24"}) || o.Workers != 16 || o.Timeout != 2*time.Second || !o.RateAdaptive || o.Rate != 50 {
+				t.Errorf("Options.LoadFile() = %+v", o)
+			}
+			if want := []string{"192.0.2.53", "192.0.2.54"}; !slices.Equal(o.Resolvers, want) {
+				t.Errorf("Options.Resolvers = %v, want %v", o.Resolvers, want)
+			}
+			// settings missing from the file keep their defaults
+			if o.MaxAttempts != DefaultOptions().MaxAttempts {
+				t.Errorf("Options.MaxAttempts = %v, want the default", o.MaxAttempts)
+			}
+		})
+	}
+}
+
+func TestOptionsLoadEnv(t *testing.T) {
+	env := map[string]string{
+		"REVERSE_SCAN_WORKERS":     "32",
+		"REVERSE_SCAN_V6_STRATEGY": "lowbyte",
+		"REVERSE_SCAN_RETRY_ON":    "refused",
+		"OTHER_WORKERS":            "1",
+	}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+
+	o := DefaultOptions()
+	if err := o.LoadEnv(lookup); err != nil {
+		t.Fatalf("Options.LoadEnv() unexpected error = %v", err)
+	}
+	if o.Workers != 32 || o.V6Strategy != StrategyLowByte || !slices.Equal(o.RetryOn, []string{"refused"}) {
+		t.Errorf("Options.LoadEnv() = %+v", o)
+	}
+
+	env["REVERSE_SCAN_TIMEOUT"] = "soon"
+	if err := o.LoadEnv(lookup); err == nil {
+		t.Error("Options.LoadEnv() should error on an invalid value")
+	}
+}
+
+func TestOptionsPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scan.json")
+	if err := os.WriteFile(path, []byte(`{"workers": 16, "timeout": "2s", "burst": 4}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	o := DefaultOptions()
+	if err := o.LoadFile(path); err != nil {
+		t.Fatalf("Options.LoadFile() unexpected error = %v", err)
+	}
+	env := map[string]string{"REVERSE_SCAN_WORKERS": "32", "REVERSE_SCAN_TIMEOUT": "3s"}
+	if err := o.LoadEnv(func(name string) (string, bool) { v, ok := env[name]; return v, ok }); err != nil {
+		t.Fatalf("Options.LoadEnv() unexpected error = %v", err)
+	}
+	// a flag
+	if err := o.Set("workers", "64"); err != nil {
+		t.Fatalf("Options.Set() unexpected error = %v", err)
+	}
+
+	if o.Workers != 64 {
+		t.Errorf("Options.Workers = %v, want the flag value 64", o.Workers)
+	}
+	if o.Timeout != 3*time.Second {
+		t.Errorf("Options.Timeout = %v, want the env value 3s", o.Timeout)
+	}
+	if o.Burst != 4 {
+		t.Errorf("Options.Burst = %v, want the file value 4", o.Burst)
+	}
+	if o.RetryDelay != DefaultOptions().RetryDelay {
+		t.Errorf("Options.RetryDelay = %v, want the default", o.RetryDelay)
+	}
+}
+
+func TestNew(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "out.csv")
+
+	o := DefaultOptions()
+	o.CIDRs = []string{"192.0.2.0/24"}
+	o.Output = output
+	c, err := New(o)
+	if err != nil {
+		t.Fatalf("New() unexpected error = %v", err)
+	}
+	if c.Hosts.Size() != 256 || c.WORKERS != 8 || c.Checkpoint != output+".checkpoint" || c.Retry.MaxAttempts != 3 {
+		t.Errorf("New() = %+v", c)
+	}
+
+	// the validation applies whatever the source of the value
+	o.Timeout = 0
+	if _, err := New(o); err == nil {
+		t.Error("New() should reject a zero timeout")
+	}
+}
+
+func TestNewTargetsFromStdin(t *testing.T) {
+	o := DefaultOptions()
+	o.Output = filepath.Join(t.TempDir(), "out.csv")
+	o.Targets = "-"
+	o.Stdin = strings.NewReader("192.0.2.0/30\n192.0.2.2-192.0.2.5\n")
+
+	c, err := New(o)
+	if err != nil {
+		t.Fatalf("New() unexpected error = %v", err)
+	}
+	if c.Hosts.Size() != 6 {
+		t.Errorf("Config.Hosts.Size() = %v, want 6 unique addresses", c.Hosts.Size())
+	}
+}
@@ -0,0 +1,244 @@
+// Package estimate infers how the addresses of a range are named from the
+// lookups of a sample of them
+package estimate
+
+import (
+	"cmp"
+	"math"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/amine7536/reverse-scan/pkg/resolver"
+)
+
+// Z is the quantile of the normal distribution of the 95% confidence intervals
+const Z = 1.96
+
+// Interval is an estimate with its 95% confidence interval
+type Interval struct {
+	Estimate float64
+	Low      float64
+	High     float64
+}
+
+// Scale returns the interval multiplied by f
+func (i Interval) Scale(f float64) Interval {
+	return Interval{Estimate: i.Estimate * f, Low: i.Low * f, High: i.High * f}
+}
+
+// Pattern is a naming pattern, the name with its digits replaced by #
+type Pattern struct {
+	Pattern string
+	// Count is the number of sampled addresses named after the pattern
+	Count uint64
+	// Share is the share of the named addresses following the pattern
+	Share Interval
+}
+
+// Report holds the estimates inferred from a sample
+type Report struct {
+	// Patterns are the naming patterns, the most common first
+	Patterns []Pattern
+	// Sampled is the number of addresses looked up
+	Sampled uint64
+	// Failed is the number of lookups that failed, they are left out of the estimates
+	Failed uint64
+	// Coverage is the share of addresses having a PTR record
+	Coverage Interval
+	// Named is the number of addresses of the population having a PTR record
+	Named Interval
+	// Blocks is the number of IPv4 /24s sampled
+	Blocks uint64
+	// NamedBlocks is the number of sampled /24s with at least one named address
+	NamedBlocks uint64
+	// Density is the mean share of named addresses in a /24
+	Density Interval
+	// Densities counts the sampled /24s per share of named addresses: none,
+	// up to 25%, 50%, 75% and up to all of them
+	Densities [5]uint64
+}
+
+// Estimator collects the lookups of a sample, it is not safe for concurrent use
+type Estimator struct {
+	blocks   map[[3]byte]*block
+	patterns map[string]uint64
+	named    uint64
+	unnamed  uint64
+	failed   uint64
+}
+
+// block counts the lookups of a /24
+type block struct {
+	named   uint64
+	unnamed uint64
+}
+
+// New returns an empty estimator
+func New() *Estimator {
+	return &Estimator{
+		blocks:   make(map[[3]byte]*block),
+		patterns: make(map[string]uint64),
+	}
+}
+
+// Add records the outcome of the lookup of ip
+func (e *Estimator) Add(ip string, status resolver.Status, names []string) {
+	var named bool
+	switch status {
+	case resolver.StatusOK:
+		named = true
+		e.named++
+		if len(names) > 0 {
+			e.patterns[PatternOf(names[0])]++
+		}
+	case resolver.StatusNXDomain:
+		e.unnamed++
+	default:
+		e.failed++
+		return
+	}
+
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || !addr.Is4() {
+		return
+	}
+
+	a := addr.As4()
+	key := [3]byte{a[0], a[1], a[2]}
+	b, ok := e.blocks[key]
+	if !ok {
+		b = &block{}
+		e.blocks[key] = b
+	}
+	if named {
+		b.named++
+	} else {
+		b.unnamed++
+	}
+}
+
+// Report returns the estimates for a population of the given number of
+// addresses the sample was drawn from
+func (e *Estimator) Report(population uint64) Report {
+	resolved := e.named + e.unnamed
+	r := Report{
+		Sampled:  resolved + e.failed,
+		Failed:   e.failed,
+		Coverage: proportion(e.named, resolved, population),
+		Blocks:   uint64(len(e.blocks)),
+	}
+	r.Named = r.Coverage.Scale(float64(population))
+
+	for pattern, count := range e.patterns {
+		r.Patterns = append(r.Patterns, Pattern{
+			Pattern: pattern,
+			Count:   count,
+			Share:   proportion(count, e.named, 0),
+		})
+	}
+	slices.SortFunc(r.Patterns, func(a, b Pattern) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Pattern, b.Pattern)
+	})
+
+	densities := make([]float64, 0, len(e.blocks))
+	for _, b := range e.blocks {
+		d := float64(b.named) / float64(b.named+b.unnamed)
+		densities = append(densities, d)
+		if b.named > 0 {
+			r.NamedBlocks++
+		}
+
+		switch {
+		case d == 0:
+			r.Densities[0]++
+		case d <= 0.25:
+			r.Densities[1]++
+		case d <= 0.5:
+			r.Densities[2]++
+		case d <= 0.75:
+			r.Densities[3]++
+		default:
+			r.Densities[4]++
+		}
+	}
+	r.Density = mean(densities)
+
+	return r
+}
+
+// PatternOf returns the naming pattern of a name: lower case with every
+// run of digits replaced by #, host-10-0-0-1.example.com. is
+// host-#-#-#-#.example.com.
+func PatternOf(name string) string {
+	var b strings.Builder
+	digits := false
+	for _, c := range strings.ToLower(name) {
+		if c >= '0' && c <= '9' {
+			if !digits {
+				b.WriteByte('#')
+			}
+			digits = true
+			continue
+		}
+		digits = false
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// proportion returns the share of k successes in n draws with its Wilson
+// score interval. The draws come without replacement from a population of
+// the given size, the interval shrinks as the sample covers more of it, zero
+// means a population much larger than the sample.
+func proportion(k, n, population uint64) Interval {
+	if n == 0 {
+		return Interval{}
+	}
+
+	p := float64(k) / float64(n)
+	if population > 0 && n >= population {
+		// the whole population was looked up
+		return Interval{Estimate: p, Low: p, High: p}
+	}
+
+	// finite population correction, applied to the sample size
+	size := float64(n)
+	if population > 1 {
+		size /= float64(population-n) / float64(population-1)
+	}
+
+	z2 := Z * Z
+	denom := 1 + z2/size
+	center := (p + z2/(2*size)) / denom
+	half := Z * math.Sqrt(p*(1-p)/size+z2/(4*size*size)) / denom
+
+	return Interval{Estimate: p, Low: math.Max(0, center-half), High: math.Min(1, center+half)}
+}
+
+// mean returns the mean of shares with the normal interval of its standard error
+func mean(shares []float64) Interval {
+	if len(shares) == 0 {
+		return Interval{}
+	}
+
+	var sum float64
+	for _, s := range shares {
+		sum += s
+	}
+	m := sum / float64(len(shares))
+	if len(shares) == 1 {
+		return Interval{Estimate: m, Low: m, High: m}
+	}
+
+	var squares float64
+	for _, s := range shares {
+		squares += (s - m) * (s - m)
+	}
+	half := Z * math.Sqrt(squares/float64(len(shares)-1)/float64(len(shares)))
+
+	return Interval{Estimate: m, Low: math.Max(0, m-half), High: math.Min(1, m+half)}
+}
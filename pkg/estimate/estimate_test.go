@@ -0,0 +1,115 @@
+package estimate
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/amine7536/reverse-scan/pkg/resolver"
+)
+
+func TestPatternOf(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "host-10-0-0-1.example.com.", want: "host-#-#-#-#.example.com."},
+		{name: "DSL123.Example.NET.", want: "dsl#.example.net."},
+		{name: "mail.example.com.", want: "mail.example.com."},
+		{name: "a1b22c333", want: "a#b#c#"},
+	}
+
+	for _, tt := range tests {
+		if got := PatternOf(tt.name); got != tt.want {
+			t.Errorf("PatternOf(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestProportion(t *testing.T) {
+	tests := []struct {
+		name      string
+		k, n, pop uint64
+		want      Interval
+	}{
+		{name: "no draw", k: 0, n: 0, want: Interval{}},
+		{name: "half", k: 50, n: 100, want: Interval{Estimate: 0.5, Low: 0.4038, High: 0.5962}},
+		{name: "none", k: 0, n: 100, want: Interval{Estimate: 0, Low: 0, High: 0.0370}},
+		{name: "all", k: 100, n: 100, want: Interval{Estimate: 1, Low: 0.9630, High: 1}},
+		// sampling half of the population narrows the interval
+		{name: "half of the population", k: 50, n: 100, pop: 200, want: Interval{Estimate: 0.5, Low: 0.4312, High: 0.5688}},
+		{name: "whole population", k: 30, n: 120, pop: 120, want: Interval{Estimate: 0.25, Low: 0.25, High: 0.25}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := proportion(tt.k, tt.n, tt.pop)
+			if !near(got.Estimate, tt.want.Estimate) || !near(got.Low, tt.want.Low) || !near(got.High, tt.want.High) {
+				t.Errorf("proportion() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReport(t *testing.T) {
+	e := New()
+
+	// 10.0.0.0/24: 8 of 10 named, 10.0.1.0/24: 2 of 10, 10.0.2.0/24: none of 4
+	for i := range 10 {
+		status, names := resolver.StatusNXDomain, []string(nil)
+		if i < 8 {
+			status, names = resolver.StatusOK, []string{fmt.Sprintf("host-%d.example.com.", i)}
+		}
+		e.Add(fmt.Sprintf("10.0.0.%d", i), status, names)
+	}
+	for i := range 10 {
+		status, names := resolver.StatusNXDomain, []string(nil)
+		if i < 2 {
+			status, names = resolver.StatusOK, []string{fmt.Sprintf("mail%d.example.com.", i)}
+		}
+		e.Add(fmt.Sprintf("10.0.1.%d", i), status, names)
+	}
+	for i := range 4 {
+		e.Add(fmt.Sprintf("10.0.2.%d", i), resolver.StatusNXDomain, nil)
+	}
+	e.Add("10.0.3.1", resolver.StatusTimeout, nil)
+	e.Add("10.0.3.2", resolver.StatusServFail, nil)
+	e.Add("2001:db8::1", resolver.StatusOK, []string{"v6.example.com."})
+
+	r := e.Report(1000)
+
+	if r.Sampled != 27 || r.Failed != 2 {
+		t.Errorf("Report() Sampled = %v, Failed = %v, want 27 and 2", r.Sampled, r.Failed)
+	}
+	if want := 11.0 / 25; !near(r.Coverage.Estimate, want) || r.Coverage.Low >= want || r.Coverage.High <= want {
+		t.Errorf("Report().Coverage = %+v, want an interval around %v", r.Coverage, want)
+	}
+	if !near(r.Named.Estimate, 440) {
+		t.Errorf("Report().Named = %+v, want 440", r.Named)
+	}
+
+	wantPatterns := []Pattern{{Pattern: "host-#.example.com.", Count: 8}, {Pattern: "mail#.example.com.", Count: 2}, {Pattern: "v#.example.com.", Count: 1}}
+	if len(r.Patterns) != len(wantPatterns) {
+		t.Fatalf("Report().Patterns = %+v, want %+v", r.Patterns, wantPatterns)
+	}
+	for i, p := range r.Patterns {
+		if p.Pattern != wantPatterns[i].Pattern || p.Count != wantPatterns[i].Count {
+			t.Errorf("Report().Patterns[%d] = %+v, want %+v", i, p, wantPatterns[i])
+		}
+	}
+
+	// failed lookups and IPv6 addresses are left out of the /24s
+	if r.Blocks != 3 || r.NamedBlocks != 2 {
+		t.Errorf("Report() Blocks = %v, NamedBlocks = %v, want 3 and 2", r.Blocks, r.NamedBlocks)
+	}
+	if want := [5]uint64{1, 1, 0, 0, 1}; r.Densities != want {
+		t.Errorf("Report().Densities = %v, want %v", r.Densities, want)
+	}
+	if want := (0.8 + 0.2 + 0) / 3; !near(r.Density.Estimate, want) || r.Density.Low >= want || r.Density.High <= want {
+		t.Errorf("Report().Density = %+v, want an interval around %v", r.Density, want)
+	}
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-4
+}
@@ -0,0 +1,118 @@
+package queue
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/amine7536/reverse-scan/pkg/resolver"
+)
+
+// Autoscaling settings: every scaleWindow, once at least scaleMinSamples
+// lookups were observed, the pool is halved when more than scaleThreshold of
+// them were refused or timed out, or when their mean latency went above
+// scaleTolerance times the lowest mean seen so far. Otherwise it grows by a
+// scaleSteps-th of the maximum number of workers.
+const (
+	scaleWindow     = time.Second
+	scaleMinSamples = 50
+	scaleThreshold  = 0.05
+	scaleTolerance  = 2.0
+	scaleSteps      = 32
+)
+
+// Autoscaler tunes the number of workers from the latency and the failures
+// of the lookups, adding workers while the resolvers keep up and backing off
+// once they slow down or start refusing queries
+type Autoscaler struct {
+	started time.Time
+	// OnResize is called with the new number of workers, the previous one
+	// and the reason of the change every time the autoscaler resizes the pool
+	OnResize func(workers, old int, reason string)
+	resize   func(n int)
+	// baseline is the lowest mean latency of a window
+	baseline time.Duration
+	// latency is the total latency of the answered lookups of the window
+	latency  time.Duration
+	workers  int
+	min      int
+	max      int
+	samples  int
+	failures int
+	answered int
+	mu       sync.Mutex
+}
+
+// NewAutoscaler returns an autoscaler keeping between minWorkers and
+// maxWorkers workers, resize sets the size of the pool. The pool starts with
+// minWorkers workers.
+func NewAutoscaler(minWorkers, maxWorkers int, resize func(n int)) *Autoscaler {
+	return &Autoscaler{
+		resize:  resize,
+		workers: minWorkers,
+		min:     minWorkers,
+		max:     maxWorkers,
+		started: time.Now(),
+	}
+}
+
+// Workers returns the current number of workers
+func (a *Autoscaler) Workers() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.workers
+}
+
+// Observe feeds the status and the latency of a lookup to the autoscaler
+func (a *Autoscaler) Observe(status resolver.Status, rtt time.Duration) {
+	a.mu.Lock()
+	a.samples++
+	switch status {
+	case resolver.StatusRefused, resolver.StatusTimeout:
+		a.failures++
+	case resolver.StatusOK, resolver.StatusNXDomain:
+		a.answered++
+		a.latency += rtt
+	}
+
+	if a.samples < scaleMinSamples || time.Since(a.started) < scaleWindow {
+		a.mu.Unlock()
+		return
+	}
+
+	ratio := float64(a.failures) / float64(a.samples)
+	var mean time.Duration
+	if a.answered > 0 {
+		mean = a.latency / time.Duration(a.answered)
+	}
+
+	old := a.workers
+	var reason string
+	switch {
+	case ratio > scaleThreshold:
+		a.workers = max(a.workers/2, a.min)
+		reason = fmt.Sprintf("%.1f%% refused or timed out", 100*ratio)
+	case a.baseline > 0 && mean > time.Duration(scaleTolerance*float64(a.baseline)):
+		a.workers = max(a.workers/2, a.min)
+		reason = fmt.Sprintf("latency %v above %.0fx the %v baseline", mean.Round(time.Microsecond), scaleTolerance, a.baseline.Round(time.Microsecond))
+	default:
+		a.workers = min(a.workers+max(a.max/scaleSteps, 1), a.max)
+		reason = fmt.Sprintf("latency %v, %.1f%% refused or timed out", mean.Round(time.Microsecond), 100*ratio)
+	}
+
+	if mean > 0 && (a.baseline == 0 || mean < a.baseline) {
+		a.baseline = mean
+	}
+	a.samples, a.failures, a.answered, a.latency, a.started = 0, 0, 0, 0, time.Now()
+
+	// resized under the lock so concurrent decisions apply in order
+	workers, onResize := a.workers, a.OnResize
+	if workers != old {
+		a.resize(workers)
+	}
+	a.mu.Unlock()
+
+	if workers != old && onResize != nil {
+		onResize(workers, old, reason)
+	}
+}
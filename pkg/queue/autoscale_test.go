@@ -0,0 +1,107 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/amine7536/reverse-scan/pkg/resolver"
+)
+
+// observeWindow feeds a full window of lookups to a
+func observeWindow(a *Autoscaler, status resolver.Status, rtt time.Duration) {
+	a.started = time.Now().Add(-2 * scaleWindow)
+	for i := 0; i < scaleMinSamples; i++ {
+		a.Observe(status, rtt)
+	}
+}
+
+func TestAutoscaler(t *testing.T) {
+	var sizes []int
+	a := NewAutoscaler(4, 64, func(n int) {
+		sizes = append(sizes, n)
+	})
+
+	var reasons []string
+	a.OnResize = func(_, _ int, reason string) {
+		reasons = append(reasons, reason)
+	}
+
+	// healthy windows add a 32nd of the maximum, up to the maximum
+	for w := 0; w < 40; w++ {
+		observeWindow(a, resolver.StatusOK, 10*time.Millisecond)
+	}
+	if got := a.Workers(); got != 64 {
+		t.Errorf("Workers() after healthy windows = %v, want 64", got)
+	}
+	if sizes[0] != 6 {
+		t.Errorf("first resize = %v, want 6", sizes[0])
+	}
+
+	// a window full of timeouts halves the pool
+	observeWindow(a, resolver.StatusTimeout, time.Second)
+	if got := a.Workers(); got != 32 {
+		t.Errorf("Workers() after timeouts = %v, want 32", got)
+	}
+
+	// so does a latency above twice the baseline
+	observeWindow(a, resolver.StatusNXDomain, 30*time.Millisecond)
+	if got := a.Workers(); got != 16 {
+		t.Errorf("Workers() after slow lookups = %v, want 16", got)
+	}
+
+	// the pool never drops below the minimum
+	for w := 0; w < 10; w++ {
+		observeWindow(a, resolver.StatusRefused, 0)
+	}
+	if got := a.Workers(); got != 4 {
+		t.Errorf("Workers() after refusals = %v, want 4", got)
+	}
+
+	if sizes[len(sizes)-1] != 4 {
+		t.Errorf("last resize = %v, want 4", sizes[len(sizes)-1])
+	}
+	if len(reasons) != len(sizes) {
+		t.Errorf("OnResize() called %d times for %d resizes", len(reasons), len(sizes))
+	}
+}
+
+func TestAutoscalerWindow(t *testing.T) {
+	resized := false
+	a := NewAutoscaler(4, 64, func(int) {
+		resized = true
+	})
+
+	// a window is not over before scaleWindow even with enough lookups
+	for i := 0; i < 2*scaleMinSamples; i++ {
+		a.Observe(resolver.StatusOK, time.Millisecond)
+	}
+	if resized || a.Workers() != 4 {
+		t.Errorf("Workers() = %v before the end of the window, want 4", a.Workers())
+	}
+}
+
+func TestLookupAutoscaler(t *testing.T) {
+	results := make(chan Result[Job, Job], scaleMinSamples)
+
+	var d *Dispatcher[Job, Job]
+	lookup := Lookup{Resolver: instantResolver{}}
+	lookup.Autoscaler = NewAutoscaler(1, 32, func(n int) {
+		d.Resize(n)
+	})
+	lookup.Autoscaler.started = time.Now().Add(-2 * scaleWindow)
+
+	d = NewDispatcher(1, lookup.Handle, results)
+	d.Run(context.Background())
+	for range scaleMinSamples {
+		d.JobQueue <- Job{IP: "192.0.2.1"}
+	}
+	d.Drain()
+
+	if got := lookup.Autoscaler.Workers(); got != 2 {
+		t.Errorf("Autoscaler.Workers() = %v, want 2", got)
+	}
+	if got := len(d.Workers); got != 2 {
+		t.Errorf("Dispatcher workers = %v, want 2", got)
+	}
+}
@@ -0,0 +1,166 @@
+package queue
+
+import (
+	"context"
+	"runtime"
+	"sync/atomic"
+	"testing"
+
+	"github.com/amine7536/reverse-scan/pkg/resolver"
+)
+
+// instantResolver answers every lookup at once
+type instantResolver struct{}
+
+func (instantResolver) LookupAddr(_ context.Context, _ string) (resolver.Answer, error) {
+	return resolver.Answer{Server: "instant", Names: []string{"instant.example.com."}}, nil
+}
+
+// yieldingResolver lets the other goroutines run a number of times before
+// answering, a lookup waiting on the network without relying on timers
+type yieldingResolver struct {
+	yields int
+}
+
+func (r yieldingResolver) LookupAddr(_ context.Context, _ string) (resolver.Answer, error) {
+	for range r.yields {
+		runtime.Gosched()
+	}
+	return resolver.Answer{Server: "yielding", Names: []string{"yielding.example.com."}}, nil
+}
+
+// legacyDispatcher is the former chan-of-chans design, kept to compare
+// against: every job received gets a goroutine waiting for an idle worker
+type legacyDispatcher struct {
+	WorkerPool  chan chan Job
+	JobQueue    chan Job
+	ResultQueue chan Result[Job, Job]
+	Handler     Handler[Job, Job]
+	MaxWorkers  int
+}
+
+func newLegacyDispatcher(maxWorkers int, handler Handler[Job, Job], results chan Result[Job, Job]) *legacyDispatcher {
+	return &legacyDispatcher{
+		WorkerPool:  make(chan chan Job, maxWorkers),
+		JobQueue:    make(chan Job),
+		ResultQueue: results,
+		Handler:     handler,
+		MaxWorkers:  maxWorkers,
+	}
+}
+
+func (d *legacyDispatcher) Run(ctx context.Context) {
+	for i := 0; i < d.MaxWorkers; i++ {
+		jobs := make(chan Job)
+		go func() {
+			for {
+				select {
+				case d.WorkerPool <- jobs:
+				case <-ctx.Done():
+					return
+				}
+
+				select {
+				case job := <-jobs:
+					out, err := d.Handler(ctx, job)
+					select {
+					case d.ResultQueue <- Result[Job, Job]{In: job, Out: out, Err: err}:
+					case <-ctx.Done():
+						return
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		for {
+			select {
+			case job := <-d.JobQueue:
+				go func(job Job) {
+					select {
+					case jobs := <-d.WorkerPool:
+						select {
+						case jobs <- job:
+						case <-ctx.Done():
+						}
+					case <-ctx.Done():
+					}
+				}(job)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+const (
+	benchWorkers = 8
+	benchJobs    = 10000
+)
+
+// benchmarkDispatcher sends benchJobs jobs per iteration to a dispatcher
+// started by run and reports the peak number of goroutines seen by the producer
+func benchmarkDispatcher(b *testing.B, run func(ctx context.Context, results chan Result[Job, Job]) chan<- Job) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	results := make(chan Result[Job, Job])
+	jobs := run(ctx, results)
+
+	var peak atomic.Int64
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		go func() {
+			for i := range benchJobs {
+				jobs <- Job{IP: "192.0.2.1", Seq: uint64(i)}
+				if i%256 == 0 {
+					if n := int64(runtime.NumGoroutine()); n > peak.Load() {
+						peak.Store(n)
+					}
+				}
+			}
+		}()
+		for range benchJobs {
+			<-results
+		}
+	}
+	b.StopTimer()
+
+	b.ReportMetric(float64(peak.Load()), "goroutines")
+	b.ReportMetric(float64(b.N*benchJobs)/b.Elapsed().Seconds(), "jobs/s")
+}
+
+// benchmarkResolvers runs the dispatcher built by run with lookups answered
+// at once and with lookups waiting, the ones that piled up goroutines
+func benchmarkResolvers(b *testing.B, run func(res resolver.Resolver) func(ctx context.Context, results chan Result[Job, Job]) chan<- Job) {
+	b.Run("instant", func(b *testing.B) {
+		benchmarkDispatcher(b, run(instantResolver{}))
+	})
+	b.Run("slow", func(b *testing.B) {
+		benchmarkDispatcher(b, run(yieldingResolver{yields: 100}))
+	})
+}
+
+func BenchmarkDispatcher(b *testing.B) {
+	benchmarkResolvers(b, func(res resolver.Resolver) func(ctx context.Context, results chan Result[Job, Job]) chan<- Job {
+		return func(ctx context.Context, results chan Result[Job, Job]) chan<- Job {
+			d := NewDispatcher(benchWorkers, Lookup{Resolver: res}.Handle, results)
+			d.Run(ctx)
+			return d.JobQueue
+		}
+	})
+}
+
+func BenchmarkLegacyDispatcher(b *testing.B) {
+	benchmarkResolvers(b, func(res resolver.Resolver) func(ctx context.Context, results chan Result[Job, Job]) chan<- Job {
+		return func(ctx context.Context, results chan Result[Job, Job]) chan<- Job {
+			d := newLegacyDispatcher(benchWorkers, Lookup{Resolver: res}.Handle, results)
+			d.Run(ctx)
+			return d.JobQueue
+		}
+	})
+}
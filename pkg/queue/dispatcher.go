@@ -1,66 +1,148 @@
 // Package queue implements a worker pool pattern for concurrent job processing
 package queue
 
-// Dispatcher dispatches jobs to workers
-type Dispatcher struct {
-	WorkerPool  chan chan Job
-	JobQueue    chan Job
-	ResultQueue chan Job
-	quit        chan bool
-	Workers     []Worker
-	MaxWorkers  int
-}
+import (
+	"context"
+	"sync"
+)
 
-// NewDispatcher returns a new dispatcher
-func NewDispatcher(maxWorkers int, results chan Job) *Dispatcher {
+// Dispatcher runs a fixed number of workers passing the inputs of a bounded
+// queue to a handler
+type Dispatcher[In, Out any] struct {
+	// JobQueue holds the inputs waiting for a worker, sending blocks while
+	// every worker is busy and the queue is full so the producer is held back
+	JobQueue    chan In
+	ResultQueue chan Result[In, Out]
+	Handler     Handler[In, Out]
+	// cancel cancels the context of the workers
+	cancel context.CancelFunc
+	// start runs a worker until the context of Run is done
+	start func(w Worker[In, Out])
+	// Workers are the running workers
+	Workers []Worker[In, Out]
+	// MaxWorkers is the number of workers started by Run
+	MaxWorkers int
+	nextID     int
+	wg         sync.WaitGroup
+	mu         sync.Mutex
+	closeOnce  sync.Once
+}
 
-	return &Dispatcher{
+// NewDispatcher returns a new dispatcher passing its inputs to handler and
+// sending the results to results
+func NewDispatcher[In, Out any](maxWorkers int, handler Handler[In, Out], results chan Result[In, Out]) *Dispatcher[In, Out] {
+	return &Dispatcher[In, Out]{
 		MaxWorkers:  maxWorkers,
-		WorkerPool:  make(chan chan Job, maxWorkers),
-		JobQueue:    make(chan Job),
+		JobQueue:    make(chan In, maxWorkers),
 		ResultQueue: results,
-		quit:        make(chan bool),
+		Handler:     handler,
+	}
+}
+
+// Run starts the workers, they stop when ctx is done, when the dispatcher
+// is stopped, or once the job queue is closed and drained
+func (d *Dispatcher[In, Out]) Run(ctx context.Context) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	ctx, d.cancel = context.WithCancel(ctx)
+	d.start = func(worker Worker[In, Out]) {
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			worker.Run(ctx)
+		}()
+	}
+	d.grow(d.MaxWorkers)
+}
+
+// Resize grows or shrinks the pool to n workers, at least one, while it
+// runs. The workers removed exit once the result of their current job is
+// received.
+func (d *Dispatcher[In, Out]) Resize(n int) {
+	n = max(n, 1)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.start == nil {
+		d.MaxWorkers = n
+		return
 	}
+	d.grow(n)
+	for len(d.Workers) > n {
+		last := len(d.Workers) - 1
+		d.Workers[last].retire()
+		d.Workers = d.Workers[:last]
+	}
+}
+
+// Size returns the number of running workers
+func (d *Dispatcher[In, Out]) Size() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.Workers)
 }
 
-// Run starts the dispatcher
-func (d *Dispatcher) Run() {
-	// starting n number of workers
-	for i := 0; i < d.MaxWorkers; i++ {
-		worker := NewWorker(i, d.WorkerPool, &d.ResultQueue)
+// grow starts workers until there are n, d.mu must be held
+func (d *Dispatcher[In, Out]) grow(n int) {
+	for len(d.Workers) < n {
+		worker := NewWorker(d.nextID, d.Handler, d.JobQueue, d.ResultQueue)
+		d.nextID++
 		d.Workers = append(d.Workers, worker)
-		worker.Start()
+		d.start(worker)
 	}
+}
 
-	go d.dispatch()
+// Close tells the dispatcher no more jobs are coming, the workers exit once
+// the queued jobs are done
+func (d *Dispatcher[In, Out]) Close() {
+	d.closeOnce.Do(func() {
+		close(d.JobQueue)
+	})
 }
 
-func (d *Dispatcher) dispatch() {
-	for {
-		select {
-		case job := <-d.JobQueue:
-			// a job request has been received
-			go func(job Job) {
-				// try to obtain a worker job channel that is available.
-				// this will block until a worker is idle
-				jobChannel := <-d.WorkerPool
-
-				// dispatch the job to the worker job channel
-				jobChannel <- job
-			}(job)
-
-		case <-d.quit:
-			for _, w := range d.Workers {
-				w.Stop()
-			}
-			return
-		}
+// Wait blocks until every worker has exited: after Close, once every job
+// sent is done and its result received
+func (d *Dispatcher[In, Out]) Wait() {
+	d.wg.Wait()
+	if d.cancel != nil {
+		d.cancel()
 	}
 }
 
-// Stop stops the dispatcher and all workers
-func (d *Dispatcher) Stop() {
+// Drain closes the job queue and blocks until every queued job is done and
+// every worker has exited. The results must be received meanwhile, no job
+// may be sent once Drain is called.
+func (d *Dispatcher[In, Out]) Drain() {
+	d.Close()
+	d.Wait()
+}
+
+// Stop abandons the queued jobs, cancels the context of the jobs in
+// progress and blocks until every worker has exited. It returns ctx's error
+// when ctx is done first, the workers then exit once their handlers return.
+// The producers must stop sending jobs, none is read once Stop is called.
+func (d *Dispatcher[In, Out]) Stop(ctx context.Context) error {
+	if d.cancel != nil {
+		d.cancel()
+	}
+	return waitFor(ctx, d.wg.Wait)
+}
+
+// waitFor calls wait and returns once it returns, or with ctx's error when
+// ctx is done first
+func waitFor(ctx context.Context, wait func()) error {
+	done := make(chan struct{})
 	go func() {
-		d.quit <- true
+		wait()
+		close(done)
 	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
@@ -0,0 +1,128 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/amine7536/reverse-scan/pkg/resolver"
+)
+
+// Job represents a DNS lookup job
+type Job struct {
+	IP     string
+	Status resolver.Status
+	Names  []string
+	// Attempts is the number of lookups made for IP
+	Attempts int
+	// Seq is the position of IP in the scan order
+	Seq uint64
+	// Resolver is the nameserver queried by the last attempt
+	Resolver string
+	// RTT is the duration of the last attempt
+	RTT time.Duration
+	// Time is when the last attempt completed
+	Time time.Time
+}
+
+// Lookup resolves the PTR records of the jobs' IPs, its Handle method is
+// the handler of a Dispatcher[Job, Job]
+type Lookup struct {
+	Resolver resolver.Resolver
+	// Timeout bounds every lookup, no limit when zero
+	Timeout time.Duration
+	// Retry decides which failed lookups are tried again
+	Retry resolver.RetryPolicy
+	// Limiter caps the query rate of all the lookups, no limit when nil
+	Limiter *RateLimiter
+	// Autoscaler tunes the number of workers from the lookups, nil when the number is fixed
+	Autoscaler *Autoscaler
+	// Stop ends the lookups once closed: the jobs handled next are not
+	// looked up and the retries end, the attempt running is not canceled and
+	// its outcome is the job's. Nil never stops.
+	Stop <-chan struct{}
+}
+
+// ErrStopped is the error of the jobs handled after Lookup.Stop was closed,
+// their IP is not looked up
+var ErrStopped = errors.New("lookup stopped")
+
+// Handle looks up the job's IP, retrying transient failures as the retry
+// policy allows until Stop is closed. The outcome is recorded in the job's
+// Status, the error is ErrStopped when Stop was closed before the first
+// attempt and nil otherwise.
+func (l Lookup) Handle(ctx context.Context, job Job) (Job, error) {
+	select {
+	case <-l.Stop:
+		return job, ErrStopped
+	default:
+	}
+
+	for job.Attempts = 1; ; job.Attempts++ {
+		err := l.lookup(ctx, &job)
+		job.Status = resolver.StatusOf(err)
+
+		if !l.Retry.Retryable(job.Status, job.Attempts) {
+			return job, nil
+		}
+		if l.wait(ctx, job.Attempts) != nil {
+			return job, nil
+		}
+	}
+}
+
+// wait sleeps for the backoff of attempt, it returns early when ctx is done
+// or Stop is closed
+func (l Lookup) wait(ctx context.Context, attempt int) error {
+	timer := time.NewTimer(l.Retry.Backoff(attempt))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-l.Stop:
+	}
+
+	// Stop wins over a backoff ending at the same time
+	select {
+	case <-l.Stop:
+		return ErrStopped
+	default:
+		return nil
+	}
+}
+
+// lookup makes one attempt at resolving the job's IP and records its outcome in job
+func (l Lookup) lookup(ctx context.Context, job *Job) error {
+	if l.Limiter != nil {
+		if err := l.Limiter.Wait(ctx); err != nil {
+			job.Names, job.RTT, job.Time = nil, 0, time.Now()
+			return err
+		}
+	}
+
+	if l.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, l.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	answer, err := l.Resolver.LookupAddr(ctx, job.IP)
+	job.Time = time.Now()
+	job.RTT = job.Time.Sub(start)
+	job.Resolver = answer.Server
+	job.Names = nil
+	if err == nil {
+		job.Names = answer.Names
+	}
+
+	if l.Limiter != nil {
+		l.Limiter.Observe(resolver.StatusOf(err))
+	}
+	if l.Autoscaler != nil {
+		l.Autoscaler.Observe(resolver.StatusOf(err), job.RTT)
+	}
+	return err
+}
@@ -0,0 +1,185 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/amine7536/reverse-scan/pkg/resolver"
+)
+
+func TestJobStruct(t *testing.T) {
+	job := Job{
+		IP:    "192.168.1.1",
+		Names: []string{"example.com", "test.com"},
+	}
+
+	if job.IP != "192.168.1.1" {
+		t.Errorf("Job.IP = %v, want 192.168.1.1", job.IP)
+	}
+	if len(job.Names) != 2 {
+		t.Errorf("Job.Names length = %v, want 2", len(job.Names))
+	}
+	if job.Names[0] != "example.com" {
+		t.Errorf("Job.Names[0] = %v, want example.com", job.Names[0])
+	}
+}
+
+// slowResolver answers after a delay, or fails when its context is done first
+type slowResolver struct {
+	delay time.Duration
+}
+
+func (r slowResolver) LookupAddr(ctx context.Context, _ string) (resolver.Answer, error) {
+	select {
+	case <-time.After(r.delay):
+		return resolver.Answer{Server: "slow", Names: []string{"slow.example.com."}}, nil
+	case <-ctx.Done():
+		return resolver.Answer{Server: "slow"}, ctx.Err()
+	}
+}
+
+func TestLookupTimeout(t *testing.T) {
+	lookup := Lookup{Resolver: slowResolver{delay: time.Minute}, Timeout: 50 * time.Millisecond}
+
+	job, err := lookup.Handle(context.Background(), Job{IP: "192.0.2.1"})
+	if err != nil {
+		t.Fatalf("Lookup.Handle() unexpected error = %v", err)
+	}
+	if job.Status != resolver.StatusTimeout {
+		t.Errorf("Lookup.Handle() Status = %v, want %v", job.Status, resolver.StatusTimeout)
+	}
+}
+
+// flakyResolver fails with SERVFAIL until it has been called failures times
+type flakyResolver struct {
+	calls    *atomic.Int32
+	failures int32
+}
+
+func (r flakyResolver) LookupAddr(_ context.Context, _ string) (resolver.Answer, error) {
+	if r.calls.Add(1) <= r.failures {
+		return resolver.Answer{Server: "flaky"}, &resolver.RcodeError{Rcode: dnsmessage.RCodeServerFailure}
+	}
+	return resolver.Answer{Server: "flaky", Names: []string{"flaky.example.com."}}, nil
+}
+
+func TestLookupRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int32
+		maxAttempts  int
+		wantStatus   resolver.Status
+		wantAttempts int
+	}{
+		{
+			name:         "success after retries",
+			failures:     2,
+			maxAttempts:  3,
+			wantStatus:   resolver.StatusOK,
+			wantAttempts: 3,
+		},
+		{
+			name:         "attempts exhausted",
+			failures:     5,
+			maxAttempts:  3,
+			wantStatus:   resolver.StatusServFail,
+			wantAttempts: 3,
+		},
+		{
+			name:         "retries disabled",
+			failures:     1,
+			maxAttempts:  1,
+			wantStatus:   resolver.StatusServFail,
+			wantAttempts: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lookup := Lookup{
+				Resolver: flakyResolver{calls: &atomic.Int32{}, failures: tt.failures},
+				Retry: resolver.RetryPolicy{
+					MaxAttempts: tt.maxAttempts,
+					BaseDelay:   time.Millisecond,
+					RetryOn:     []resolver.Status{resolver.StatusServFail},
+				},
+			}
+
+			result, err := lookup.Handle(context.Background(), Job{IP: "192.0.2.1"})
+			if err != nil {
+				t.Fatalf("Lookup.Handle() unexpected error = %v", err)
+			}
+			if result.Status != tt.wantStatus {
+				t.Errorf("Result Status = %v, want %v", result.Status, tt.wantStatus)
+			}
+			if result.Attempts != tt.wantAttempts {
+				t.Errorf("Result Attempts = %v, want %v", result.Attempts, tt.wantAttempts)
+			}
+			if result.Resolver != "flaky" {
+				t.Errorf("Result Resolver = %v, want flaky", result.Resolver)
+			}
+			if result.Time.IsZero() {
+				t.Error("Result Time is not set")
+			}
+		})
+	}
+}
+
+// stoppingResolver fails with SERVFAIL and closes stop on the first call, an
+// interrupt arriving while the first attempt runs
+type stoppingResolver struct {
+	calls *atomic.Int32
+	stop  chan struct{}
+}
+
+func (r stoppingResolver) LookupAddr(_ context.Context, _ string) (resolver.Answer, error) {
+	if r.calls.Add(1) == 1 {
+		close(r.stop)
+	}
+	return resolver.Answer{Server: "stopping"}, &resolver.RcodeError{Rcode: dnsmessage.RCodeServerFailure}
+}
+
+func TestLookupStopEndsRetries(t *testing.T) {
+	stop := make(chan struct{})
+	calls := &atomic.Int32{}
+	lookup := Lookup{
+		Resolver: stoppingResolver{calls: calls, stop: stop},
+		Retry: resolver.RetryPolicy{
+			MaxAttempts: 4,
+			BaseDelay:   time.Millisecond,
+			RetryOn:     []resolver.Status{resolver.StatusServFail},
+		},
+		Stop: stop,
+	}
+
+	job, err := lookup.Handle(context.Background(), Job{IP: "192.0.2.1"})
+	if err != nil {
+		t.Fatalf("Lookup.Handle() unexpected error = %v", err)
+	}
+	if job.Attempts != 1 || calls.Load() != 1 {
+		t.Errorf("Lookup.Handle() made %d attempts and %d queries after Stop, want 1 and 1", job.Attempts, calls.Load())
+	}
+	if job.Status != resolver.StatusServFail {
+		t.Errorf("Lookup.Handle() Status = %v, want the one of the attempt %v", job.Status, resolver.StatusServFail)
+	}
+}
+
+func TestLookupStoppedStartsNothing(t *testing.T) {
+	stop := make(chan struct{})
+	close(stop)
+	calls := &atomic.Int32{}
+	lookup := Lookup{Resolver: flakyResolver{calls: calls}, Stop: stop}
+
+	job, err := lookup.Handle(context.Background(), Job{IP: "192.0.2.1"})
+	if !errors.Is(err, ErrStopped) {
+		t.Errorf("Lookup.Handle() error = %v, want %v", err, ErrStopped)
+	}
+	if job.Attempts != 0 || calls.Load() != 0 {
+		t.Errorf("Lookup.Handle() made %d attempts and %d queries after Stop, want none", job.Attempts, calls.Load())
+	}
+}
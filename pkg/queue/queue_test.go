@@ -1,12 +1,57 @@
 package queue
 
 import (
+	"context"
+	"errors"
+	"runtime"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/amine7536/reverse-scan/pkg/resolver"
 )
 
+// systemLookup resolves the jobs with the system resolver
+var systemLookup = Lookup{Resolver: resolver.System{}}.Handle
+
+// delayedLookup resolves the jobs after delay
+func delayedLookup(delay time.Duration) Handler[Job, Job] {
+	return Lookup{Resolver: slowResolver{delay: delay}}.Handle
+}
+
+// checkGoroutines fails the test when goroutines started during the test
+// are still running once it ends
+func checkGoroutines(t *testing.T) {
+	t.Helper()
+	before := runtime.NumGoroutine()
+	t.Cleanup(func() {
+		// exiting goroutines take a moment to be gone
+		deadline := time.Now().Add(time.Second)
+		for runtime.NumGoroutine() > before {
+			if time.Now().After(deadline) {
+				buf := make([]byte, 1<<16)
+				n := runtime.Stack(buf, true)
+				t.Errorf("%d goroutines leaked:\n%s", runtime.NumGoroutine()-before, buf[:n])
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+}
+
+// stopDispatcher stops d, failing the test when its workers do not exit in time
+func stopDispatcher[In, Out any](t *testing.T, d *Dispatcher[In, Out]) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := d.Stop(ctx); err != nil {
+		t.Errorf("Dispatcher.Stop() error = %v", err)
+	}
+}
+
 func TestNewDispatcher(t *testing.T) {
-	results := make(chan Job)
+	results := make(chan Result[Job, Job])
 	defer close(results)
 
 	tests := []struct {
@@ -29,18 +74,15 @@ func TestNewDispatcher(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			d := NewDispatcher(tt.maxWorkers, results)
+			d := NewDispatcher(tt.maxWorkers, systemLookup, results)
 			if d == nil {
 				t.Fatal("NewDispatcher() returned nil")
 			}
 			if d.MaxWorkers != tt.maxWorkers {
 				t.Errorf("NewDispatcher() MaxWorkers = %v, want %v", d.MaxWorkers, tt.maxWorkers)
 			}
-			if d.WorkerPool == nil {
-				t.Error("NewDispatcher() WorkerPool is nil")
-			}
-			if d.JobQueue == nil {
-				t.Error("NewDispatcher() JobQueue is nil")
+			if cap(d.JobQueue) != tt.maxWorkers {
+				t.Errorf("NewDispatcher() JobQueue capacity = %v, want %v", cap(d.JobQueue), tt.maxWorkers)
 			}
 			if d.ResultQueue == nil {
 				t.Error("NewDispatcher() ResultQueue is nil")
@@ -50,37 +92,31 @@ func TestNewDispatcher(t *testing.T) {
 }
 
 func TestDispatcherRunStop(t *testing.T) {
-	results := make(chan Job, 10)
+	results := make(chan Result[Job, Job], 10)
 	defer close(results)
 
-	d := NewDispatcher(2, results)
-	d.Run()
+	checkGoroutines(t)
 
-	// Give workers time to start
-	time.Sleep(50 * time.Millisecond)
+	d := NewDispatcher(2, systemLookup, results)
+	d.Run(context.Background())
 
 	// Verify workers were created
 	if len(d.Workers) != 2 {
 		t.Errorf("Run() created %d workers, want 2", len(d.Workers))
 	}
 
-	// Stop the dispatcher
-	d.Stop()
-
-	// Give time for cleanup
-	time.Sleep(50 * time.Millisecond)
+	// Stop returns once the workers have exited
+	stopDispatcher(t, d)
+	stopDispatcher(t, d)
 }
 
 func TestDispatcherProcessJob(t *testing.T) {
-	results := make(chan Job, 10)
+	results := make(chan Result[Job, Job], 10)
 	defer close(results)
 
-	d := NewDispatcher(2, results)
-	d.Run()
-	defer d.Stop()
-
-	// Give workers time to start
-	time.Sleep(50 * time.Millisecond)
+	d := NewDispatcher(2, systemLookup, results)
+	d.Run(context.Background())
+	defer stopDispatcher(t, d)
 
 	// Send a test job
 	testIP := "127.0.0.1"
@@ -89,7 +125,8 @@ func TestDispatcherProcessJob(t *testing.T) {
 
 	// Wait for result with timeout
 	select {
-	case result := <-results:
+	case r := <-results:
+		result := r.Out
 		if result.IP != testIP {
 			t.Errorf("Result IP = %v, want %v", result.IP, testIP)
 		}
@@ -101,15 +138,12 @@ func TestDispatcherProcessJob(t *testing.T) {
 }
 
 func TestDispatcherMultipleJobs(t *testing.T) {
-	results := make(chan Job, 20)
+	results := make(chan Result[Job, Job], 20)
 	defer close(results)
 
-	d := NewDispatcher(4, results)
-	d.Run()
-	defer d.Stop()
-
-	// Give workers time to start
-	time.Sleep(50 * time.Millisecond)
+	d := NewDispatcher(4, systemLookup, results)
+	d.Run(context.Background())
+	defer stopDispatcher(t, d)
 
 	// Send multiple jobs
 	testJobs := []string{
@@ -134,13 +168,13 @@ func TestDispatcherMultipleJobs(t *testing.T) {
 			receivedJobs++
 			found := false
 			for _, ip := range testJobs {
-				if result.IP == ip {
+				if result.Out.IP == ip {
 					found = true
 					break
 				}
 			}
 			if !found {
-				t.Errorf("Received unexpected job with IP %v", result.IP)
+				t.Errorf("Received unexpected job with IP %v", result.Out.IP)
 			}
 		case <-timeout:
 			t.Fatalf("Timeout: received %d jobs, expected %d", receivedJobs, len(testJobs))
@@ -153,116 +187,100 @@ func TestDispatcherMultipleJobs(t *testing.T) {
 }
 
 func TestNewWorker(t *testing.T) {
-	workerPool := make(chan chan Job)
-	results := make(chan Job)
+	jobs := make(chan Job)
+	results := make(chan Result[Job, Job])
 
-	worker := NewWorker(1, workerPool, &results)
+	worker := NewWorker(1, systemLookup, jobs, results)
 
 	if worker.ID != 1 {
 		t.Errorf("NewWorker() ID = %v, want 1", worker.ID)
 	}
-	if worker.WorkerPool == nil {
-		t.Error("NewWorker() WorkerPool is nil")
-	}
-	if worker.JobChannel == nil {
-		t.Error("NewWorker() JobChannel is nil")
+	if worker.JobQueue == nil {
+		t.Error("NewWorker() JobQueue is nil")
 	}
 	if worker.ResultChannel == nil {
 		t.Error("NewWorker() ResultChannel is nil")
 	}
+	if worker.Handler == nil {
+		t.Error("NewWorker() Handler is nil")
+	}
 }
 
 func TestWorkerStartStop(t *testing.T) {
-	workerPool := make(chan chan Job, 1)
-	results := make(chan Job, 10)
+	jobs := make(chan Job)
+	results := make(chan Result[Job, Job], 10)
 
-	worker := NewWorker(1, workerPool, &results)
-	worker.Start()
+	checkGoroutines(t)
 
-	// Give worker time to start
-	time.Sleep(50 * time.Millisecond)
+	worker := NewWorker(1, systemLookup, jobs, results)
+	worker.Start(context.Background())
 
-	// Worker should register itself in the pool
-	select {
-	case jobChan := <-workerPool:
-		if jobChan == nil {
-			t.Error("Worker registered nil job channel")
+	// Stop is safe to call more than once
+	for range 2 {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		if err := worker.Stop(ctx); err != nil {
+			t.Errorf("Worker.Stop() error = %v", err)
 		}
-	case <-time.After(1 * time.Second):
-		t.Fatal("Worker did not register in pool")
+		cancel()
 	}
-
-	// Stop the worker
-	worker.Stop()
-	time.Sleep(50 * time.Millisecond)
 }
 
 func TestWorkerProcessJob(t *testing.T) {
-	workerPool := make(chan chan Job, 1)
-	results := make(chan Job, 10)
-
-	worker := NewWorker(1, workerPool, &results)
-	worker.Start()
-	defer worker.Stop()
-
-	// Give worker time to start and register
-	time.Sleep(50 * time.Millisecond)
+	jobs := make(chan Job, 1)
+	results := make(chan Result[Job, Job], 10)
 
-	// Get the worker's job channel
-	var jobChan chan Job
-	select {
-	case jobChan = <-workerPool:
-	case <-time.After(1 * time.Second):
-		t.Fatal("Worker did not register in pool")
-	}
+	worker := NewWorker(1, systemLookup, jobs, results)
+	worker.Start(context.Background())
+	defer worker.Stop(context.Background()) //nolint:errcheck
 
 	// Send a job to the worker
 	testIP := "127.0.0.1"
-	jobChan <- Job{IP: testIP}
+	jobs <- Job{IP: testIP}
 
 	// Wait for result
 	select {
-	case result := <-results:
+	case r := <-results:
+		result := r.Out
 		if result.IP != testIP {
 			t.Errorf("Result IP = %v, want %v", result.IP, testIP)
 		}
-		t.Logf("Worker processed job: IP=%s, Names=%v", result.IP, result.Names)
+		if result.Status == "" {
+			t.Error("Result Status is empty")
+		}
+		t.Logf("Worker processed job: IP=%s, Status=%s, Names=%v", result.IP, result.Status, result.Names)
 	case <-time.After(5 * time.Second):
 		t.Fatal("Timeout waiting for worker result")
 	}
 }
 
-func TestJobStruct(t *testing.T) {
-	job := Job{
-		IP:    "192.168.1.1",
-		Names: []string{"example.com", "test.com"},
+func TestWorkerExitsOnClose(t *testing.T) {
+	jobs := make(chan Job, 3)
+	results := make(chan Result[Job, Job], 3)
+	for i := range 3 {
+		jobs <- Job{IP: "192.0.2.1", Seq: uint64(i)}
 	}
+	close(jobs)
 
-	if job.IP != "192.168.1.1" {
-		t.Errorf("Job.IP = %v, want 192.168.1.1", job.IP)
-	}
-	if len(job.Names) != 2 {
-		t.Errorf("Job.Names length = %v, want 2", len(job.Names))
-	}
-	if job.Names[0] != "example.com" {
-		t.Errorf("Job.Names[0] = %v, want example.com", job.Names[0])
+	worker := NewWorker(1, delayedLookup(time.Millisecond), jobs, results)
+
+	// Run returns once the closed queue is drained
+	worker.Run(context.Background())
+	if len(results) != 3 {
+		t.Errorf("Worker processed %d jobs, want 3", len(results))
 	}
 }
 
 // TestDispatcherConcurrency tests that multiple workers can process jobs concurrently
 func TestDispatcherConcurrency(t *testing.T) {
-	results := make(chan Job, 100)
+	results := make(chan Result[Job, Job], 100)
 	defer close(results)
 
 	numWorkers := 10
 	numJobs := 50
 
-	d := NewDispatcher(numWorkers, results)
-	d.Run()
-	defer d.Stop()
-
-	// Give workers time to start
-	time.Sleep(100 * time.Millisecond)
+	d := NewDispatcher(numWorkers, systemLookup, results)
+	d.Run(context.Background())
+	defer stopDispatcher(t, d)
 
 	// Send jobs
 	startTime := time.Now()
@@ -290,3 +308,367 @@ func TestDispatcherConcurrency(t *testing.T) {
 		t.Errorf("Received %d jobs, want %d", receivedJobs, numJobs)
 	}
 }
+
+func TestDispatcherContextCancel(t *testing.T) {
+	checkGoroutines(t)
+
+	results := make(chan Result[Job, Job], 10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d := NewDispatcher(2, delayedLookup(time.Millisecond), results)
+	d.Run(ctx)
+
+	d.JobQueue <- Job{IP: "192.0.2.1"}
+	select {
+	case <-results:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for job result")
+	}
+
+	cancel()
+
+	// Once canceled the workers exit without taking the queued jobs
+	waited := make(chan struct{})
+	go func() {
+		d.Wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wait() did not return after the context was canceled")
+	}
+
+	d.JobQueue <- Job{IP: "192.0.2.2"}
+	select {
+	case <-results:
+		t.Error("Dispatcher processed a job after its context was canceled")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestDispatcherWait(t *testing.T) {
+	checkGoroutines(t)
+
+	results := make(chan Result[Job, Job])
+
+	d := NewDispatcher(4, delayedLookup(time.Millisecond), results)
+	d.Run(context.Background())
+	defer stopDispatcher(t, d)
+
+	const numJobs = 100
+	go func() {
+		defer d.Close()
+		for i := range numJobs {
+			d.JobQueue <- Job{IP: "192.0.2.1", Seq: uint64(i)}
+		}
+	}()
+	go func() {
+		d.Wait()
+		close(results)
+	}()
+
+	seen := make(map[uint64]bool)
+	for r := range results {
+		seen[r.Out.Seq] = true
+	}
+	if len(seen) != numJobs {
+		t.Errorf("Wait() returned after %d jobs, want %d", len(seen), numJobs)
+	}
+}
+
+// blockingHandler returns its input once release is closed
+type blockingHandler struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (h blockingHandler) Handle(_ context.Context, n int) (int, error) {
+	h.started <- struct{}{}
+	<-h.release
+	return n, nil
+}
+
+func TestDispatcherBackpressure(t *testing.T) {
+	checkGoroutines(t)
+
+	const numWorkers = 4
+	results := make(chan Result[int, int], 100)
+	res := blockingHandler{started: make(chan struct{}, numWorkers), release: make(chan struct{})}
+
+	d := NewDispatcher(numWorkers, res.Handle, results)
+	d.Run(context.Background())
+
+	// every worker takes a job, then the queue fills up
+	for range numWorkers {
+		d.JobQueue <- 1
+		<-res.started
+	}
+	for range cap(d.JobQueue) {
+		d.JobQueue <- 1
+	}
+
+	select {
+	case d.JobQueue <- 1:
+		t.Error("Dispatcher accepted a job while its workers and queue were full")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(res.release)
+	d.Close()
+	go func() {
+		// the queued jobs reach the handler once released
+		for range res.started {
+		}
+	}()
+	d.Wait()
+	close(res.started)
+	if len(results) != numWorkers+cap(d.JobQueue) {
+		t.Errorf("Dispatcher returned %d results, want %d", len(results), numWorkers+cap(d.JobQueue))
+	}
+}
+func TestDispatcherHandler(t *testing.T) {
+	checkGoroutines(t)
+
+	errOdd := errors.New("odd")
+	handler := func(_ context.Context, n int) (string, error) {
+		if n%2 == 1 {
+			return "", errOdd
+		}
+		return strconv.Itoa(n * n), nil
+	}
+
+	results := make(chan Result[int, string])
+	d := NewDispatcher(3, handler, results)
+	d.Run(context.Background())
+
+	go func() {
+		defer d.Close()
+		for n := range 10 {
+			d.JobQueue <- n
+		}
+	}()
+	go func() {
+		d.Wait()
+		close(results)
+	}()
+
+	got := make(map[int]Result[int, string])
+	for r := range results {
+		got[r.In] = r
+	}
+	if len(got) != 10 {
+		t.Fatalf("Dispatcher returned %d results, want 10", len(got))
+	}
+	for n, r := range got {
+		if n%2 == 1 {
+			if !errors.Is(r.Err, errOdd) {
+				t.Errorf("Result[%d].Err = %v, want %v", n, r.Err, errOdd)
+			}
+			continue
+		}
+		if want := strconv.Itoa(n * n); r.Out != want || r.Err != nil {
+			t.Errorf("Result[%d] = %q, %v, want %q, nil", n, r.Out, r.Err, want)
+		}
+	}
+}
+
+// waitingHandler returns its input once release is closed, or fails once
+// its context is done
+type waitingHandler struct {
+	started chan int
+	release chan struct{}
+}
+
+func (h waitingHandler) Handle(ctx context.Context, n int) (int, error) {
+	h.started <- n
+	select {
+	case <-h.release:
+		return n, nil
+	case <-ctx.Done():
+		return n, ctx.Err()
+	}
+}
+
+func TestDispatcherStop(t *testing.T) {
+	checkGoroutines(t)
+
+	const numWorkers = 2
+	results := make(chan Result[int, int], 10)
+	h := waitingHandler{started: make(chan int, 10), release: make(chan struct{})}
+
+	d := NewDispatcher(numWorkers, h.Handle, results)
+	d.Run(context.Background())
+
+	for n := range numWorkers {
+		d.JobQueue <- n
+		<-h.started
+	}
+	for n := range cap(d.JobQueue) {
+		d.JobQueue <- numWorkers + n
+	}
+
+	stopDispatcher(t, d)
+
+	// the jobs in progress were canceled, the queued ones never started
+	if len(h.started) != 0 {
+		t.Errorf("Stop() started %d queued jobs, want 0", len(h.started))
+	}
+	close(results)
+	for r := range results {
+		if !errors.Is(r.Err, context.Canceled) {
+			t.Errorf("Result[%d].Err = %v, want %v", r.In, r.Err, context.Canceled)
+		}
+	}
+}
+
+func TestDispatcherStopTimeout(t *testing.T) {
+	checkGoroutines(t)
+
+	results := make(chan Result[int, int], 10)
+	h := blockingHandler{started: make(chan struct{}, 1), release: make(chan struct{})}
+
+	d := NewDispatcher(1, h.Handle, results)
+	d.Run(context.Background())
+	d.JobQueue <- 1
+	<-h.started
+
+	// the handler ignores its context, Stop gives up waiting for it
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := d.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Dispatcher.Stop() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	close(h.release)
+	stopDispatcher(t, d)
+}
+
+func TestDispatcherDrain(t *testing.T) {
+	checkGoroutines(t)
+
+	results := make(chan Result[int, int])
+	d := NewDispatcher(4, func(_ context.Context, n int) (int, error) {
+		return 2 * n, nil
+	}, results)
+	d.Run(context.Background())
+
+	const numJobs = 50
+	go func() {
+		for n := range numJobs {
+			d.JobQueue <- n
+		}
+		// every queued job is done once Drain returns
+		d.Drain()
+		close(results)
+	}()
+
+	var received int
+	for r := range results {
+		received++
+		if r.Out != 2*r.In {
+			t.Errorf("Result[%d].Out = %v, want %v", r.In, r.Out, 2*r.In)
+		}
+	}
+	if received != numJobs {
+		t.Errorf("Drain() returned after %d jobs, want %d", received, numJobs)
+	}
+}
+
+func TestWorkerRecoversPanic(t *testing.T) {
+	checkGoroutines(t)
+
+	errBug := errors.New("bug")
+	handler := func(_ context.Context, n int) (int, error) {
+		switch n {
+		case 2:
+			panic("handler bug")
+		case 3:
+			panic(errBug)
+		}
+		return n, nil
+	}
+
+	jobs := make(chan int, 5)
+	results := make(chan Result[int, int], 5)
+	for n := range 5 {
+		jobs <- n
+	}
+	close(jobs)
+
+	// the worker goes on with the next jobs
+	NewWorker(1, handler, jobs, results).Run(context.Background())
+	close(results)
+
+	var panics int
+	for r := range results {
+		var perr *PanicError
+		if !errors.As(r.Err, &perr) {
+			if r.Err != nil || r.Out != r.In {
+				t.Errorf("Result[%d] = %v, %v, want %v, nil", r.In, r.Out, r.Err, r.In)
+			}
+			continue
+		}
+
+		panics++
+		if r.Out != 0 {
+			t.Errorf("Result[%d].Out = %v, want the zero value", r.In, r.Out)
+		}
+		if !strings.Contains(string(perr.Stack), "TestWorkerRecoversPanic") {
+			t.Errorf("PanicError.Stack = %s, want the stack of the handler", perr.Stack)
+		}
+		if r.In == 3 && !errors.Is(r.Err, errBug) {
+			t.Errorf("Result[3].Err = %v, want it to wrap %v", r.Err, errBug)
+		}
+	}
+	if panics != 2 {
+		t.Errorf("Worker recovered %d panics, want 2", panics)
+	}
+}
+
+func TestDispatcherResize(t *testing.T) {
+	checkGoroutines(t)
+
+	results := make(chan Result[int, int])
+	d := NewDispatcher(2, func(_ context.Context, n int) (int, error) {
+		time.Sleep(time.Millisecond)
+		return n, nil
+	}, results)
+
+	// before Run the size is the number of workers to start
+	d.Resize(3)
+	d.Run(context.Background())
+	if got := d.Size(); got != 3 {
+		t.Errorf("Size() = %v, want 3", got)
+	}
+
+	const numJobs = 200
+	go func() {
+		for n := range numJobs {
+			// resizing while the jobs run loses none of them
+			switch n {
+			case 50:
+				d.Resize(8)
+			case 100:
+				d.Resize(1)
+			case 150:
+				d.Resize(0)
+			}
+			d.JobQueue <- n
+		}
+		d.Drain()
+		close(results)
+	}()
+
+	seen := make(map[int]bool)
+	for r := range results {
+		seen[r.In] = true
+	}
+	if len(seen) != numJobs {
+		t.Errorf("Dispatcher returned %d results, want %d", len(seen), numJobs)
+	}
+	// the pool keeps at least one worker
+	if got := d.Size(); got != 1 {
+		t.Errorf("Size() = %v, want 1", got)
+	}
+}
@@ -0,0 +1,136 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/amine7536/reverse-scan/pkg/resolver"
+)
+
+// Adaptive rate settings: every adaptWindow, once at least adaptMinSamples
+// lookups were observed, the rate is halved when more than adaptThreshold of
+// them were refused or timed out, and raised back by a tenth of the maximum
+// rate otherwise. It never drops below the maximum rate divided by adaptFloor.
+const (
+	adaptWindow     = time.Second
+	adaptMinSamples = 50
+	adaptThreshold  = 0.05
+	adaptFloor      = 32
+)
+
+// RateLimiter is a token bucket capping the queries per second of all the
+// workers sharing it
+type RateLimiter struct {
+	last    time.Time
+	started time.Time
+	// OnAdjust is called with the new rate and the failure ratio that caused
+	// it every time an adaptive limiter changes its rate
+	OnAdjust func(rate, failureRatio float64)
+	rate     float64
+	maxRate  float64
+	burst    float64
+	tokens   float64
+	samples  int
+	failures int
+	mu       sync.Mutex
+	adaptive bool
+}
+
+// NewRateLimiter returns a limiter allowing qps queries per second with bursts
+// of up to burst queries. An adaptive limiter backs off when resolvers start
+// refusing or dropping queries.
+func NewRateLimiter(qps float64, burst int, adaptive bool) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	now := time.Now()
+	return &RateLimiter{
+		rate:     qps,
+		maxRate:  qps,
+		burst:    float64(burst),
+		tokens:   float64(burst),
+		adaptive: adaptive,
+		last:     now,
+		started:  now,
+	}
+}
+
+// Rate returns the current queries per second
+func (l *RateLimiter) Rate() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// Wait blocks until a query may be sent or ctx is done
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	// take the token now, waiting for the bucket to refill if it went negative
+	l.tokens--
+	wait := time.Duration(0)
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if wait == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// give the unused token back
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Observe feeds the status of a lookup to an adaptive limiter
+func (l *RateLimiter) Observe(status resolver.Status) {
+	if !l.adaptive {
+		return
+	}
+
+	l.mu.Lock()
+	l.samples++
+	if status == resolver.StatusRefused || status == resolver.StatusTimeout {
+		l.failures++
+	}
+
+	if l.samples < adaptMinSamples || time.Since(l.started) < adaptWindow {
+		l.mu.Unlock()
+		return
+	}
+
+	ratio := float64(l.failures) / float64(l.samples)
+	old := l.rate
+	if ratio > adaptThreshold {
+		l.rate = max(l.rate/2, l.maxRate/adaptFloor)
+	} else {
+		l.rate = min(l.rate+l.maxRate/10, l.maxRate)
+	}
+	l.samples, l.failures, l.started = 0, 0, time.Now()
+
+	rate, onAdjust := l.rate, l.OnAdjust
+	l.mu.Unlock()
+
+	if rate != old && onAdjust != nil {
+		onAdjust(rate, ratio)
+	}
+}
@@ -0,0 +1,144 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/amine7536/reverse-scan/pkg/resolver"
+)
+
+func TestRateLimiterWait(t *testing.T) {
+	l := NewRateLimiter(100, 1, false)
+
+	// 21 queries at 100 qps without burst take at least 200ms
+	start := time.Now()
+	for i := 0; i < 21; i++ {
+		if err := l.Wait(context.Background()); err != nil {
+			t.Fatalf("Wait() unexpected error = %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 190*time.Millisecond {
+		t.Errorf("21 queries at 100 qps took %v, want at least 200ms", elapsed)
+	}
+}
+
+func TestRateLimiterBurst(t *testing.T) {
+	l := NewRateLimiter(1, 10, false)
+
+	// a full bucket lets the burst go through at once
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		if err := l.Wait(context.Background()); err != nil {
+			t.Fatalf("Wait() unexpected error = %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("burst of 10 queries took %v, want no wait", elapsed)
+	}
+}
+
+func TestRateLimiterShared(t *testing.T) {
+	l := NewRateLimiter(200, 1, false)
+
+	// 8 workers sharing the limiter send 41 queries at 200 qps in about 200ms
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	sent := 0
+	start := time.Now()
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				mu.Lock()
+				if sent == 41 {
+					mu.Unlock()
+					return
+				}
+				sent++
+				mu.Unlock()
+				if err := l.Wait(context.Background()); err != nil {
+					t.Errorf("Wait() unexpected error = %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if elapsed := time.Since(start); elapsed < 190*time.Millisecond {
+		t.Errorf("41 queries at 200 qps over 8 workers took %v, want at least 200ms", elapsed)
+	}
+}
+
+func TestRateLimiterWaitCanceled(t *testing.T) {
+	l := NewRateLimiter(0.001, 1, false)
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait() unexpected error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := l.Wait(ctx); err == nil {
+		t.Error("Wait() should return the context error when canceled")
+	}
+}
+
+func TestRateLimiterAdaptive(t *testing.T) {
+	l := NewRateLimiter(100, 1, true)
+	l.started = time.Now().Add(-2 * adaptWindow)
+
+	var adjusted []float64
+	l.OnAdjust = func(rate, _ float64) {
+		adjusted = append(adjusted, rate)
+	}
+
+	// a window full of refused queries halves the rate
+	for i := 0; i < adaptMinSamples; i++ {
+		l.Observe(resolver.StatusRefused)
+	}
+	if got := l.Rate(); got != 50 {
+		t.Errorf("Rate() after refusals = %v, want 50", got)
+	}
+
+	// healthy windows raise it back up to the maximum
+	for w := 0; w < 10; w++ {
+		l.started = time.Now().Add(-2 * adaptWindow)
+		for i := 0; i < adaptMinSamples; i++ {
+			l.Observe(resolver.StatusOK)
+		}
+	}
+	if got := l.Rate(); got != 100 {
+		t.Errorf("Rate() after recovery = %v, want 100", got)
+	}
+
+	// the rate never drops below the floor
+	for w := 0; w < 20; w++ {
+		l.started = time.Now().Add(-2 * adaptWindow)
+		for i := 0; i < adaptMinSamples; i++ {
+			l.Observe(resolver.StatusTimeout)
+		}
+	}
+	if got := l.Rate(); got != 100.0/adaptFloor {
+		t.Errorf("Rate() after timeouts = %v, want %v", got, 100.0/adaptFloor)
+	}
+
+	if len(adjusted) == 0 || adjusted[0] != 50 {
+		t.Errorf("OnAdjust() calls = %v, want first one at 50", adjusted)
+	}
+}
+
+func TestRateLimiterNotAdaptive(t *testing.T) {
+	l := NewRateLimiter(100, 1, false)
+	l.started = time.Now().Add(-2 * adaptWindow)
+
+	for i := 0; i < 2*adaptMinSamples; i++ {
+		l.Observe(resolver.StatusRefused)
+	}
+	if got := l.Rate(); got != 100 {
+		t.Errorf("Rate() = %v, want 100", got)
+	}
+}
@@ -1,64 +1,149 @@
 package queue
 
 import (
-	"github.com/amine7536/reverse-scan/pkg/utils"
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
 )
 
-// Job represents a DNS lookup job
-type Job struct {
-	IP    string
-	Names []string
+// Handler computes the output of an input, it is called by the workers
+// concurrently
+type Handler[In, Out any] func(ctx context.Context, in In) (Out, error)
+
+// Result is the outcome of the handler for an input
+type Result[In, Out any] struct {
+	In  In
+	Out Out
+	Err error
+}
+
+// PanicError is the error of a job whose handler panicked, the worker
+// recovers and goes on with the next job
+type PanicError struct {
+	// Value is the value passed to panic
+	Value any
+	// Stack is the stack trace of the handler when it panicked
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Unwrap returns the panic value when it is an error
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
 }
 
-// Worker executes a reverse lookup on a slice of ips
-type Worker struct {
-	WorkerPool    chan chan Job
-	JobChannel    chan Job
-	ResultChannel chan Job
-	quit          chan bool
-	ID            int
+// Worker passes the inputs it reads from JobQueue to its handler
+type Worker[In, Out any] struct {
+	JobQueue      <-chan In
+	ResultChannel chan<- Result[In, Out]
+	Handler       Handler[In, Out]
+	quit          chan struct{}
+	// retiring is closed to stop the worker before it takes a new job
+	retiring chan struct{}
+	// done is closed once Run returns
+	done     chan struct{}
+	stopOnce *sync.Once
+	ID       int
 }
 
-// NewWorker returns a new Worker
-func NewWorker(id int, workerPool chan chan Job, resultQueue *chan Job) Worker {
-	return Worker{
+// NewWorker returns a new Worker reading inputs from jobs and sending their
+// results to results
+func NewWorker[In, Out any](id int, handler Handler[In, Out], jobs <-chan In, results chan<- Result[In, Out]) Worker[In, Out] {
+	return Worker[In, Out]{
 		ID:            id,
-		WorkerPool:    workerPool,
-		JobChannel:    make(chan Job),
-		ResultChannel: *resultQueue,
-		quit:          make(chan bool),
+		JobQueue:      jobs,
+		ResultChannel: results,
+		Handler:       handler,
+		quit:          make(chan struct{}),
+		retiring:      make(chan struct{}),
+		done:          make(chan struct{}),
+		stopOnce:      &sync.Once{},
 	}
 }
 
-// Start run the worker
-func (w Worker) Start() {
-	go func() {
-		for {
-			// register the current worker into the worker queue.
-			w.WorkerPool <- w.JobChannel
+// Start runs the worker in a new goroutine
+func (w Worker[In, Out]) Start(ctx context.Context) {
+	go w.Run(ctx)
+}
 
-			select {
-			case job := <-w.JobChannel:
-				// Send the return of fn in the ResultChannel
-				names, err := utils.ResolveName(job.IP)
-				if err == nil {
-					job.Names = names
-				}
-				w.ResultChannel <- job
+// Run processes jobs until the job queue is closed and drained, ctx is
+// done or the worker is stopped. A worker runs once.
+func (w Worker[In, Out]) Run(ctx context.Context) {
+	defer close(w.done)
+	for {
+		// a stopped worker takes no new job, even one already queued
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.quit:
+			return
+		case <-w.retiring:
+			return
+		default:
+		}
 
-			case <-w.quit:
-				// Stop working
-				// log.Printf("Stopping WorkerID=%v", w.ID)
+		select {
+		case in, ok := <-w.JobQueue:
+			if !ok {
 				return
+			}
+			out, err := w.handle(ctx, in)
 
+			select {
+			case w.ResultChannel <- Result[In, Out]{In: in, Out: out, Err: err}:
+			case <-ctx.Done():
+				return
+			case <-w.quit:
+				return
 			}
+
+		case <-ctx.Done():
+			return
+
+		case <-w.quit:
+			return
+
+		case <-w.retiring:
+			return
 		}
-	}()
+	}
 }
 
-// Stop the Worker
-func (w Worker) Stop() {
-	go func() {
-		w.quit <- true
+// handle calls the handler, a panic is returned as a *PanicError with a
+// zero output
+func (w Worker[In, Out]) handle(ctx context.Context, in In) (out Out, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			var zero Out
+			out, err = zero, &PanicError{Value: v, Stack: debug.Stack()}
+		}
 	}()
+	return w.Handler(ctx, in)
+}
+
+// retire stops the worker once the result of its current job is received,
+// it is called once
+func (w Worker[In, Out]) retire() {
+	close(w.retiring)
+}
+
+// Stop stops the worker once its current job is done, its result is
+// dropped unless it is received at once. Stop blocks until Run returns, or
+// returns ctx's error when ctx is done first.
+func (w Worker[In, Out]) Stop(ctx context.Context) error {
+	w.stopOnce.Do(func() {
+		close(w.quit)
+	})
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
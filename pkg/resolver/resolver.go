@@ -0,0 +1,427 @@
+// Package resolver performs reverse DNS lookups, either through the system
+// resolver or by querying nameservers directly
+package resolver
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/amine7536/reverse-scan/pkg/utils"
+)
+
+// DefaultTimeout bounds every query sent by a Client
+const DefaultTimeout = 5 * time.Second
+
+// udpSize is the EDNS0 payload size advertised to servers, large enough to
+// avoid most TCP fallbacks while staying below common path MTUs
+const udpSize = 1232
+
+// ErrNoPTR is returned when a server answers successfully without any PTR record
+var ErrNoPTR = errors.New("no PTR record")
+
+// Status classifies the outcome of a lookup
+type Status string
+
+// Lookup statuses, a failed lookup (servfail, refused, timeout, other) may be
+// retried while nxdomain means the address has no name. A lookup whose code
+// panicked has the panic status, it is never retried.
+const (
+	StatusOK       Status = "ok"
+	StatusNXDomain Status = "nxdomain"
+	StatusServFail Status = "servfail"
+	StatusRefused  Status = "refused"
+	StatusTimeout  Status = "timeout"
+	StatusOther    Status = "other"
+	StatusPanic    Status = "panic"
+)
+
+// StatusOf classifies the error returned by a lookup
+func StatusOf(err error) Status {
+	if err == nil {
+		return StatusOK
+	}
+
+	if errors.Is(err, ErrNoPTR) {
+		return StatusNXDomain
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return StatusTimeout
+	}
+
+	var rcodeErr *RcodeError
+	if errors.As(err, &rcodeErr) {
+		switch rcodeErr.Rcode {
+		case dnsmessage.RCodeNameError:
+			return StatusNXDomain
+		case dnsmessage.RCodeServerFailure:
+			return StatusServFail
+		case dnsmessage.RCodeRefused:
+			return StatusRefused
+		default:
+			return StatusOther
+		}
+	}
+
+	// Errors of the system resolver
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		switch {
+		case dnsErr.IsNotFound:
+			return StatusNXDomain
+		case dnsErr.IsTimeout:
+			return StatusTimeout
+		case dnsErr.Err == "server misbehaving":
+			return StatusServFail
+		default:
+			return StatusOther
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return StatusTimeout
+	}
+
+	return StatusOther
+}
+
+// SystemServer names the system resolver in answers
+const SystemServer = "system"
+
+// Answer is the outcome of a lookup
+type Answer struct {
+	// Server is the nameserver queried, also set when the lookup failed
+	Server string
+	Names  []string
+}
+
+// Resolver looks up the names of an IP address
+type Resolver interface {
+	LookupAddr(ctx context.Context, ip string) (Answer, error)
+}
+
+// System resolves names with the host's resolver configuration
+type System struct{}
+
+// LookupAddr performs a reverse lookup through the system resolver
+func (System) LookupAddr(ctx context.Context, ip string) (Answer, error) {
+	names, err := utils.ResolveName(ctx, ip)
+	return Answer{Server: SystemServer, Names: names}, err
+}
+
+// RcodeError is returned when a server answers with an error response code
+type RcodeError struct {
+	Server string
+	Rcode  dnsmessage.RCode
+}
+
+func (e *RcodeError) Error() string {
+	return fmt.Sprintf("%s answered %v", e.Server, e.Rcode)
+}
+
+// Client sends PTR queries straight to a list of nameservers, each query
+// going to the next server in turn. Queries use UDP and fall back to TCP when
+// the answer is truncated, unless TCP is set. Timeout bounds queries whose
+// context has no earlier deadline.
+type Client struct {
+	Servers []string
+	TCP     bool
+	Timeout time.Duration
+	next    atomic.Uint64
+}
+
+// NewClient returns a Client querying the given host:port nameservers,
+// the port defaults to 53
+func NewClient(servers []string, tcp bool) (*Client, error) {
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("must specify at least one resolver")
+	}
+
+	c := &Client{TCP: tcp, Timeout: DefaultTimeout}
+	for _, s := range servers {
+		server, err := ParseServer(s)
+		if err != nil {
+			return nil, err
+		}
+		c.Servers = append(c.Servers, server)
+	}
+
+	return c, nil
+}
+
+// ParseServer validates a nameserver address and returns it in host:port form
+func ParseServer(s string) (string, error) {
+	host, port, err := net.SplitHostPort(s)
+	if err != nil {
+		// no port given, s is a bare IPv4 or IPv6 address
+		host, port = s, "53"
+	}
+
+	if _, err := netip.ParseAddr(host); err != nil {
+		return "", fmt.Errorf("invalid resolver %q: must be an IP address with an optional port", s)
+	}
+
+	if p, err := net.LookupPort("udp", port); err != nil || p == 0 {
+		return "", fmt.Errorf("invalid resolver %q: bad port %q", s, port)
+	}
+
+	return net.JoinHostPort(host, port), nil
+}
+
+// LookupAddr queries the next nameserver for the PTR records of ip
+func (c *Client) LookupAddr(ctx context.Context, ip string) (Answer, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return Answer{}, fmt.Errorf("invalid IP: %q", ip)
+	}
+
+	name, err := dnsmessage.NewName(utils.ReverseName(addr))
+	if err != nil {
+		return Answer{}, err
+	}
+
+	server := c.Servers[(c.next.Add(1)-1)%uint64(len(c.Servers))]
+	names, err := c.query(ctx, server, name)
+	return Answer{Server: server, Names: names}, err
+}
+
+func (c *Client) query(ctx context.Context, server string, name dnsmessage.Name) ([]string, error) {
+	id := uint16(rand.Uint32())
+	msg, err := newQuery(id, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !c.TCP {
+		resp, err := c.exchangeUDP(ctx, server, id, name, msg)
+		if err != nil {
+			return nil, err
+		}
+
+		names, truncated, err := parseResponse(server, id, name, resp)
+		if !truncated {
+			return names, err
+		}
+	}
+
+	resp, err := c.exchangeTCP(ctx, server, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	names, _, err := parseResponse(server, id, name, resp)
+	return names, err
+}
+
+func (c *Client) timeout() time.Duration {
+	if c.Timeout <= 0 {
+		return DefaultTimeout
+	}
+	return c.Timeout
+}
+
+// dial connects to server, the connection deadline follows ctx and is
+// cut short when ctx is canceled. The returned function releases the connection.
+func (c *Client) dial(ctx context.Context, network, server string) (net.Conn, func(), error) {
+	deadline := time.Now().Add(c.timeout())
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	dialer := net.Dialer{Deadline: deadline}
+	conn, err := dialer.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := conn.SetDeadline(deadline); err != nil {
+		//nolint:errcheck
+		conn.Close()
+		return nil, nil, err
+	}
+
+	// unblock pending reads and writes as soon as ctx is done
+	stop := context.AfterFunc(ctx, func() {
+		//nolint:errcheck
+		conn.SetDeadline(time.Unix(1, 0))
+	})
+
+	return conn, func() {
+		stop()
+		//nolint:errcheck
+		conn.Close()
+	}, nil
+}
+
+// ctxErr reports the context error over the I/O error it caused
+func ctxErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// exchangeUDP sends msg and returns the first response to the query id for
+// name. Stray or spoofed datagrams are dropped and the read goes on until
+// the deadline, as the resolver of net does.
+func (c *Client) exchangeUDP(ctx context.Context, server string, id uint16, name dnsmessage.Name, msg []byte) ([]byte, error) {
+	conn, release, err := c.dial(ctx, "udp", server)
+	if err != nil {
+		return nil, ctxErr(ctx, err)
+	}
+	defer release()
+
+	if _, err := conn.Write(msg); err != nil {
+		return nil, ctxErr(ctx, err)
+	}
+
+	buf := make([]byte, udpSize)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, ctxErr(ctx, err)
+		}
+		if answers(id, name, buf[:n]) {
+			return buf[:n], nil
+		}
+	}
+}
+
+func (c *Client) exchangeTCP(ctx context.Context, server string, msg []byte) ([]byte, error) {
+	conn, release, err := c.dial(ctx, "tcp", server)
+	if err != nil {
+		return nil, ctxErr(ctx, err)
+	}
+	defer release()
+
+	// TCP messages are prefixed with their length
+	framed := binary.BigEndian.AppendUint16(nil, uint16(len(msg)))
+	if _, err := conn.Write(append(framed, msg...)); err != nil {
+		return nil, ctxErr(ctx, err)
+	}
+
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, ctxErr(ctx, err)
+	}
+
+	buf := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return nil, ctxErr(ctx, err)
+	}
+	return buf, nil
+}
+
+func newQuery(id uint16, name dnsmessage.Name) ([]byte, error) {
+	b := dnsmessage.NewBuilder(make([]byte, 0, 128), dnsmessage.Header{
+		ID:               id,
+		RecursionDesired: true,
+	})
+	b.EnableCompression()
+
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(dnsmessage.Question{
+		Name:  name,
+		Type:  dnsmessage.TypePTR,
+		Class: dnsmessage.ClassINET,
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := b.StartAdditionals(); err != nil {
+		return nil, err
+	}
+	var opt dnsmessage.ResourceHeader
+	if err := opt.SetEDNS0(udpSize, dnsmessage.RCodeSuccess, false); err != nil {
+		return nil, err
+	}
+	if err := b.OPTResource(opt, dnsmessage.OPTResource{}); err != nil {
+		return nil, err
+	}
+
+	return b.Finish()
+}
+
+// answers reports whether resp is a response to the PTR query id for name
+func answers(id uint16, name dnsmessage.Name, resp []byte) bool {
+	var p dnsmessage.Parser
+	h, err := p.Start(resp)
+	if err != nil || h.ID != id || !h.Response {
+		return false
+	}
+
+	q, err := p.Question()
+	if err != nil {
+		return false
+	}
+	return q.Type == dnsmessage.TypePTR && q.Class == dnsmessage.ClassINET && strings.EqualFold(q.Name.String(), name.String())
+}
+
+// parseResponse extracts the PTR names of a response, truncated reports
+// that the answer must be fetched again over TCP
+func parseResponse(server string, id uint16, name dnsmessage.Name, resp []byte) (names []string, truncated bool, err error) {
+	var p dnsmessage.Parser
+	h, err := p.Start(resp)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid response from %s: %w", server, err)
+	}
+
+	if !answers(id, name, resp) {
+		return nil, false, fmt.Errorf("invalid response from %s: mismatched query", server)
+	}
+
+	if h.Truncated {
+		return nil, true, nil
+	}
+
+	if h.RCode != dnsmessage.RCodeSuccess {
+		return nil, false, &RcodeError{Server: server, Rcode: h.RCode}
+	}
+
+	if err := p.SkipAllQuestions(); err != nil {
+		return nil, false, fmt.Errorf("invalid response from %s: %w", server, err)
+	}
+
+	for {
+		ah, err := p.AnswerHeader()
+		if errors.Is(err, dnsmessage.ErrSectionDone) {
+			break
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid response from %s: %w", server, err)
+		}
+
+		// CNAMEs of classless delegations (RFC 2317) come with their PTR target
+		if ah.Type != dnsmessage.TypePTR {
+			if err := p.SkipAnswer(); err != nil {
+				return nil, false, fmt.Errorf("invalid response from %s: %w", server, err)
+			}
+			continue
+		}
+
+		ptr, err := p.PTRResource()
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid response from %s: %w", server, err)
+		}
+		names = append(names, ptr.PTR.String())
+	}
+
+	if len(names) == 0 {
+		return nil, false, ErrNoPTR
+	}
+	return names, false, nil
+}
@@ -0,0 +1,546 @@
+package resolver
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// fakeRecord describes how the fake server answers a reverse name
+type fakeRecord struct {
+	names     []string
+	rcode     dnsmessage.RCode
+	truncated bool // answer truncated over UDP, complete over TCP
+	strays    bool // stray datagrams sent before the answer over UDP
+}
+
+// fakeServer is an in-process DNS server answering over UDP and TCP on the same port
+type fakeServer struct {
+	addr    string
+	records map[string]fakeRecord
+	udp     atomic.Int32
+	tcp     atomic.Int32
+}
+
+func newFakeServer(t *testing.T, records map[string]fakeRecord) *fakeServer {
+	t.Helper()
+
+	var pc net.PacketConn
+	var ln net.Listener
+	for i := 0; i < 10; i++ {
+		var err error
+		pc, err = net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Failed to listen on UDP: %v", err)
+		}
+		ln, err = net.Listen("tcp", pc.LocalAddr().String())
+		if err == nil {
+			break
+		}
+		//nolint:errcheck
+		pc.Close()
+		pc = nil
+	}
+	if pc == nil {
+		t.Fatal("Failed to listen on the same UDP and TCP port")
+	}
+
+	s := &fakeServer{addr: pc.LocalAddr().String(), records: records}
+	t.Cleanup(func() {
+		//nolint:errcheck
+		pc.Close()
+		//nolint:errcheck
+		ln.Close()
+	})
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, from, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			s.udp.Add(1)
+			for _, stray := range s.strays(buf[:n]) {
+				//nolint:errcheck
+				pc.WriteTo(stray, from)
+			}
+			if resp := s.answer(buf[:n], true); resp != nil {
+				//nolint:errcheck
+				pc.WriteTo(resp, from)
+			}
+		}
+	}()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.tcp.Add(1)
+			go s.serveTCP(conn)
+		}
+	}()
+
+	return s
+}
+
+func (s *fakeServer) serveTCP(conn net.Conn) {
+	//nolint:errcheck
+	defer conn.Close()
+
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, msg); err != nil {
+		return
+	}
+
+	resp := s.answer(msg, false)
+	//nolint:errcheck
+	conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(resp))), resp...))
+}
+
+func (s *fakeServer) answer(msg []byte, udp bool) []byte {
+	var p dnsmessage.Parser
+	h, err := p.Start(msg)
+	if err != nil {
+		return nil
+	}
+	q, err := p.Question()
+	if err != nil {
+		return nil
+	}
+
+	rec, ok := s.records[q.Name.String()]
+	if !ok {
+		rec = fakeRecord{rcode: dnsmessage.RCodeNameError}
+	}
+
+	rh := dnsmessage.Header{ID: h.ID, Response: true, RCode: rec.rcode}
+	if udp && rec.truncated {
+		rh.Truncated = true
+	}
+	return reply(rh, q, rec.names)
+}
+
+// strays returns the datagrams a client must drop before the answer to msg:
+// one with another ID, one answering another name and one that is a query
+func (s *fakeServer) strays(msg []byte) [][]byte {
+	var p dnsmessage.Parser
+	h, err := p.Start(msg)
+	if err != nil {
+		return nil
+	}
+	q, err := p.Question()
+	if err != nil || !s.records[q.Name.String()].strays {
+		return nil
+	}
+
+	other := q
+	other.Name = dnsmessage.MustNewName("9.9.9.9.in-addr.arpa.")
+	spoofed := []string{"spoofed.example.com."}
+	return [][]byte{
+		reply(dnsmessage.Header{ID: h.ID + 1, Response: true}, q, spoofed),
+		reply(dnsmessage.Header{ID: h.ID, Response: true}, other, spoofed),
+		reply(dnsmessage.Header{ID: h.ID}, q, spoofed),
+	}
+}
+
+// reply builds a response with the header rh answering q with names
+func reply(rh dnsmessage.Header, q dnsmessage.Question, names []string) []byte {
+	b := dnsmessage.NewBuilder(nil, rh)
+	if err := b.StartQuestions(); err != nil {
+		return nil
+	}
+	if err := b.Question(q); err != nil {
+		return nil
+	}
+	if err := b.StartAnswers(); err != nil {
+		return nil
+	}
+	if !rh.Truncated {
+		for _, name := range names {
+			hdr := dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET, TTL: 60}
+			if err := b.PTRResource(hdr, dnsmessage.PTRResource{PTR: dnsmessage.MustNewName(name)}); err != nil {
+				return nil
+			}
+		}
+	}
+
+	resp, err := b.Finish()
+	if err != nil {
+		return nil
+	}
+	return resp
+}
+
+func TestParseServer(t *testing.T) {
+	tests := []struct {
+		name    string
+		server  string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "IPv4 with port",
+			server: "127.0.0.1:5353",
+			want:   "127.0.0.1:5353",
+		},
+		{
+			name:   "IPv4 without port",
+			server: "9.9.9.9",
+			want:   "9.9.9.9:53",
+		},
+		{
+			name:   "IPv6 with port",
+			server: "[2001:db8::53]:5353",
+			want:   "[2001:db8::53]:5353",
+		},
+		{
+			name:   "IPv6 without port",
+			server: "2001:db8::53",
+			want:   "[2001:db8::53]:53",
+		},
+		{
+			name:    "hostname",
+			server:  "dns.example.com:53",
+			wantErr: true,
+		},
+		{
+			name:    "invalid port",
+			server:  "127.0.0.1:99999",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseServer(tt.server)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseServer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseServer() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientLookupAddr(t *testing.T) {
+	server := newFakeServer(t, map[string]fakeRecord{
+		"1.2.0.192.in-addr.arpa.": {names: []string{"host1.example.com."}},
+		"2.2.0.192.in-addr.arpa.": {names: []string{"a.example.com.", "b.example.com."}},
+		"3.2.0.192.in-addr.arpa.": {rcode: dnsmessage.RCodeServerFailure},
+		"4.2.0.192.in-addr.arpa.": {},
+		"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.": {names: []string{"v6.example.com."}},
+	})
+
+	client, err := NewClient([]string{server.addr}, false)
+	if err != nil {
+		t.Fatalf("NewClient() unexpected error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		ip        string
+		want      []string
+		wantRcode dnsmessage.RCode
+		wantErr   error
+	}{
+		{
+			name: "single PTR",
+			ip:   "192.0.2.1",
+			want: []string{"host1.example.com."},
+		},
+		{
+			name: "multiple PTR",
+			ip:   "192.0.2.2",
+			want: []string{"a.example.com.", "b.example.com."},
+		},
+		{
+			name: "IPv6 PTR",
+			ip:   "2001:db8::1",
+			want: []string{"v6.example.com."},
+		},
+		{
+			name:      "SERVFAIL",
+			ip:        "192.0.2.3",
+			wantRcode: dnsmessage.RCodeServerFailure,
+		},
+		{
+			name:      "NXDOMAIN",
+			ip:        "192.0.2.99",
+			wantRcode: dnsmessage.RCodeNameError,
+		},
+		{
+			name:    "no PTR record",
+			ip:      "192.0.2.4",
+			wantErr: ErrNoPTR,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			answer, err := client.LookupAddr(context.Background(), tt.ip)
+			names := answer.Names
+			if answer.Server != server.addr {
+				t.Errorf("LookupAddr() Server = %v, want %v", answer.Server, server.addr)
+			}
+
+			var rcodeErr *RcodeError
+			switch {
+			case tt.wantRcode != 0:
+				if !errors.As(err, &rcodeErr) || rcodeErr.Rcode != tt.wantRcode {
+					t.Fatalf("LookupAddr() error = %v, want rcode %v", err, tt.wantRcode)
+				}
+				return
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("LookupAddr() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			case err != nil:
+				t.Fatalf("LookupAddr() unexpected error = %v", err)
+			}
+
+			if len(names) != len(tt.want) {
+				t.Fatalf("LookupAddr() = %v, want %v", names, tt.want)
+			}
+			for i := range tt.want {
+				if names[i] != tt.want[i] {
+					t.Errorf("LookupAddr()[%d] = %v, want %v", i, names[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestClientTruncatedFallsBackToTCP(t *testing.T) {
+	server := newFakeServer(t, map[string]fakeRecord{
+		"1.2.0.192.in-addr.arpa.": {names: []string{"big.example.com."}, truncated: true},
+	})
+
+	client, err := NewClient([]string{server.addr}, false)
+	if err != nil {
+		t.Fatalf("NewClient() unexpected error = %v", err)
+	}
+
+	answer, err := client.LookupAddr(context.Background(), "192.0.2.1")
+	if err != nil {
+		t.Fatalf("LookupAddr() unexpected error = %v", err)
+	}
+	if len(answer.Names) != 1 || answer.Names[0] != "big.example.com." {
+		t.Errorf("LookupAddr() = %v, want [big.example.com.]", answer.Names)
+	}
+	if server.udp.Load() != 1 || server.tcp.Load() != 1 {
+		t.Errorf("server got %d UDP and %d TCP queries, want 1 and 1", server.udp.Load(), server.tcp.Load())
+	}
+}
+
+func TestClientDropsStrayResponses(t *testing.T) {
+	server := newFakeServer(t, map[string]fakeRecord{
+		"1.2.0.192.in-addr.arpa.": {names: []string{"host1.example.com."}, strays: true},
+	})
+
+	client, err := NewClient([]string{server.addr}, false)
+	if err != nil {
+		t.Fatalf("NewClient() unexpected error = %v", err)
+	}
+
+	answer, err := client.LookupAddr(context.Background(), "192.0.2.1")
+	if err != nil {
+		t.Fatalf("LookupAddr() unexpected error = %v", err)
+	}
+	if len(answer.Names) != 1 || answer.Names[0] != "host1.example.com." {
+		t.Errorf("LookupAddr() = %v, want [host1.example.com.]", answer.Names)
+	}
+	if server.udp.Load() != 1 || server.tcp.Load() != 0 {
+		t.Errorf("server got %d UDP and %d TCP queries, want 1 and 0", server.udp.Load(), server.tcp.Load())
+	}
+}
+
+func TestClientTCPOnly(t *testing.T) {
+	server := newFakeServer(t, map[string]fakeRecord{
+		"1.2.0.192.in-addr.arpa.": {names: []string{"host1.example.com."}},
+	})
+
+	client, err := NewClient([]string{server.addr}, true)
+	if err != nil {
+		t.Fatalf("NewClient() unexpected error = %v", err)
+	}
+
+	if _, err := client.LookupAddr(context.Background(), "192.0.2.1"); err != nil {
+		t.Fatalf("LookupAddr() unexpected error = %v", err)
+	}
+	if server.udp.Load() != 0 || server.tcp.Load() != 1 {
+		t.Errorf("server got %d UDP and %d TCP queries, want 0 and 1", server.udp.Load(), server.tcp.Load())
+	}
+}
+
+func TestClientRoundRobin(t *testing.T) {
+	records := map[string]fakeRecord{
+		"1.2.0.192.in-addr.arpa.": {names: []string{"host1.example.com."}},
+	}
+	first := newFakeServer(t, records)
+	second := newFakeServer(t, records)
+
+	client, err := NewClient([]string{first.addr, second.addr}, false)
+	if err != nil {
+		t.Fatalf("NewClient() unexpected error = %v", err)
+	}
+
+	for i := 0; i < 4; i++ {
+		if _, err := client.LookupAddr(context.Background(), "192.0.2.1"); err != nil {
+			t.Fatalf("LookupAddr() unexpected error = %v", err)
+		}
+	}
+	if first.udp.Load() != 2 || second.udp.Load() != 2 {
+		t.Errorf("servers got %d and %d queries, want 2 and 2", first.udp.Load(), second.udp.Load())
+	}
+}
+
+func TestNewClientNoServers(t *testing.T) {
+	if _, err := NewClient(nil, false); err == nil {
+		t.Error("NewClient() should error without servers")
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestStatusOf(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want Status
+	}{
+		{
+			name: "success",
+			want: StatusOK,
+		},
+		{
+			name: "no PTR record",
+			err:  ErrNoPTR,
+			want: StatusNXDomain,
+		},
+		{
+			name: "NXDOMAIN",
+			err:  &RcodeError{Rcode: dnsmessage.RCodeNameError},
+			want: StatusNXDomain,
+		},
+		{
+			name: "SERVFAIL",
+			err:  &RcodeError{Rcode: dnsmessage.RCodeServerFailure},
+			want: StatusServFail,
+		},
+		{
+			name: "REFUSED",
+			err:  &RcodeError{Rcode: dnsmessage.RCodeRefused},
+			want: StatusRefused,
+		},
+		{
+			name: "NOTIMP",
+			err:  &RcodeError{Rcode: dnsmessage.RCodeNotImplemented},
+			want: StatusOther,
+		},
+		{
+			name: "network timeout",
+			err:  &net.OpError{Op: "read", Err: timeoutError{}},
+			want: StatusTimeout,
+		},
+		{
+			name: "system resolver not found",
+			err:  &net.DNSError{Err: "no such host", IsNotFound: true},
+			want: StatusNXDomain,
+		},
+		{
+			name: "system resolver timeout",
+			err:  &net.DNSError{Err: "i/o timeout", IsTimeout: true},
+			want: StatusTimeout,
+		},
+		{
+			name: "system resolver SERVFAIL",
+			err:  &net.DNSError{Err: "server misbehaving"},
+			want: StatusServFail,
+		},
+		{
+			name: "unknown error",
+			err:  errors.New("boom"),
+			want: StatusOther,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StatusOf(tt.err); got != tt.want {
+				t.Errorf("StatusOf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	// A UDP socket that never answers
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen on UDP: %v", err)
+	}
+	//nolint:errcheck
+	defer pc.Close()
+
+	client, err := NewClient([]string{pc.LocalAddr().String()}, false)
+	if err != nil {
+		t.Fatalf("NewClient() unexpected error = %v", err)
+	}
+	client.Timeout = time.Minute
+
+	// The context deadline takes over the longer client timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = client.LookupAddr(ctx, "192.0.2.1")
+	if got := StatusOf(err); got != StatusTimeout {
+		t.Errorf("StatusOf(LookupAddr()) = %v, want %v (err = %v)", got, StatusTimeout, err)
+	}
+}
+
+func TestClientContextCanceled(t *testing.T) {
+	// A UDP socket that never answers
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen on UDP: %v", err)
+	}
+	//nolint:errcheck
+	defer pc.Close()
+
+	client, err := NewClient([]string{pc.LocalAddr().String()}, false)
+	if err != nil {
+		t.Fatalf("NewClient() unexpected error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err = client.LookupAddr(ctx, "192.0.2.1")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("LookupAddr() error = %v, want %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("LookupAddr() returned after %v, want it to stop on cancel", elapsed)
+	}
+}
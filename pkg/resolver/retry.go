@@ -0,0 +1,85 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"time"
+)
+
+// Default retry settings
+const (
+	DefaultMaxAttempts   = 3
+	DefaultRetryDelay    = 200 * time.Millisecond
+	DefaultRetryMaxDelay = 5 * time.Second
+)
+
+// RetryPolicy decides whether and when a failed lookup is tried again.
+// The zero value performs a single attempt.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one
+	MaxAttempts int
+	// BaseDelay is the backoff before the first retry, doubled on every retry
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff, no cap when zero
+	MaxDelay time.Duration
+	// RetryOn lists the statuses worth another attempt
+	RetryOn []Status
+}
+
+// ParseRetryOn validates a list of statuses to retry on, only failures can be retried
+func ParseRetryOn(statuses []string) ([]Status, error) {
+	retryable := []Status{StatusServFail, StatusRefused, StatusTimeout, StatusOther}
+
+	var retryOn []Status
+	for _, s := range statuses {
+		status := Status(s)
+		if !slices.Contains(retryable, status) {
+			return nil, fmt.Errorf("invalid retry status %q: must be one of servfail, refused, timeout, other", s)
+		}
+		retryOn = append(retryOn, status)
+	}
+	return retryOn, nil
+}
+
+// Retryable reports whether a lookup that ended with status after attempt
+// attempts should be tried again
+func (p RetryPolicy) Retryable(status Status, attempt int) bool {
+	return attempt < p.MaxAttempts && slices.Contains(p.RetryOn, status)
+}
+
+// Backoff returns the delay to wait after attempt attempts, an exponential
+// backoff with full jitter: a random duration up to BaseDelay*2^(attempt-1)
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	if p.BaseDelay <= 0 {
+		return 0
+	}
+
+	ceiling := p.BaseDelay
+	for i := 1; i < attempt; i++ {
+		if (p.MaxDelay > 0 && ceiling >= p.MaxDelay) || ceiling > math.MaxInt64/2 {
+			break
+		}
+		ceiling *= 2
+	}
+	if p.MaxDelay > 0 && ceiling > p.MaxDelay {
+		ceiling = p.MaxDelay
+	}
+
+	return rand.N(ceiling + 1)
+}
+
+// Wait sleeps for the backoff of attempt, it returns early with ctx's error when ctx is done
+func (p RetryPolicy) Wait(ctx context.Context, attempt int) error {
+	timer := time.NewTimer(p.Backoff(attempt))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
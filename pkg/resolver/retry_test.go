@@ -0,0 +1,128 @@
+package resolver
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseRetryOn(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []string
+		wantErr  bool
+	}{
+		{
+			name:     "transient failures",
+			statuses: []string{"timeout", "servfail"},
+		},
+		{
+			name:     "all failures",
+			statuses: []string{"timeout", "servfail", "refused", "other"},
+		},
+		{
+			name: "no retry",
+		},
+		{
+			name:     "success",
+			statuses: []string{"ok"},
+			wantErr:  true,
+		},
+		{
+			name:     "nxdomain",
+			statuses: []string{"nxdomain"},
+			wantErr:  true,
+		},
+		{
+			name:     "unknown status",
+			statuses: []string{"lost"},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRetryOn(tt.statuses)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRetryOn() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && len(got) != len(tt.statuses) {
+				t.Errorf("ParseRetryOn() = %v, want %v", got, tt.statuses)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyRetryable(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 3, RetryOn: []Status{StatusTimeout, StatusServFail}}
+
+	tests := []struct {
+		name    string
+		status  Status
+		attempt int
+		want    bool
+	}{
+		{name: "timeout on first attempt", status: StatusTimeout, attempt: 1, want: true},
+		{name: "servfail on second attempt", status: StatusServFail, attempt: 2, want: true},
+		{name: "timeout on last attempt", status: StatusTimeout, attempt: 3, want: false},
+		{name: "refused not retried", status: StatusRefused, attempt: 1, want: false},
+		{name: "nxdomain not retried", status: StatusNXDomain, attempt: 1, want: false},
+		{name: "success not retried", status: StatusOK, attempt: 1, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.Retryable(tt.status, tt.attempt); got != tt.want {
+				t.Errorf("Retryable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	var zero RetryPolicy
+	if zero.Retryable(StatusTimeout, 1) {
+		t.Error("zero RetryPolicy should not retry")
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	tests := []struct {
+		attempt int
+		ceiling time.Duration
+	}{
+		{attempt: 1, ceiling: 100 * time.Millisecond},
+		{attempt: 2, ceiling: 200 * time.Millisecond},
+		{attempt: 3, ceiling: 400 * time.Millisecond},
+		{attempt: 5, ceiling: time.Second},
+		{attempt: 100, ceiling: time.Second},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			if got := p.Backoff(tt.attempt); got < 0 || got > tt.ceiling {
+				t.Fatalf("Backoff(%d) = %v, want between 0 and %v", tt.attempt, got, tt.ceiling)
+			}
+		}
+	}
+
+	if got := (RetryPolicy{}).Backoff(3); got != 0 {
+		t.Errorf("Backoff() without base delay = %v, want 0", got)
+	}
+
+	uncapped := RetryPolicy{BaseDelay: time.Second}
+	if got := uncapped.Backoff(1000); got < 0 {
+		t.Errorf("Backoff() overflowed to %v", got)
+	}
+}
+
+func TestRetryPolicyWaitCanceled(t *testing.T) {
+	p := RetryPolicy{BaseDelay: time.Hour, MaxDelay: time.Hour}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := p.Wait(ctx, 10); err == nil {
+		t.Error("Wait() should return the context error when canceled")
+	}
+}
@@ -0,0 +1,266 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net/netip"
+	"os"
+
+	"github.com/amine7536/reverse-scan/pkg/resolver"
+	"github.com/amine7536/reverse-scan/pkg/utils"
+)
+
+// MergeReport describes the outputs combined by Merge
+type MergeReport struct {
+	// Overlaps are the addresses found in more than one input
+	Overlaps []utils.Range
+	// Gaps are runs of consecutive expected addresses found in no input
+	Gaps []utils.Range
+	// Rows is the number of rows written, one per address
+	Rows uint64
+	// Duplicates is the number of rows dropped because their address had another row
+	Duplicates uint64
+	// Missing is the number of expected addresses found in no input
+	Missing uint64
+	// Unexpected is the number of rows of addresses that were not expected, they are kept
+	Unexpected uint64
+}
+
+// mergeRow is a row of an output, kept encoded as it was read. The fields
+// are exported to spill the row to disk.
+type mergeRow struct {
+	IP     netip.Addr
+	Status resolver.Status
+	Line   []byte
+	// Seq is the position of the row among the rows of every input
+	Seq uint64
+}
+
+// Merge combines the outputs of the shards of a scan, written in format,
+// into a single output sorted by IP holding one row per address. When an
+// address has several rows the row of a successful lookup is kept over the
+// ones of failed lookups. When expected is not nil the addresses it yields,
+// in ascending order, that no input holds are reported as gaps. Up to
+// DefaultSortWindow rows are kept in memory, the others wait in a temporary
+// file.
+func Merge(w io.Writer, format string, inputs []string, expected utils.Generator) (MergeReport, error) {
+	return merge(w, format, inputs, expected, DefaultSortWindow, os.TempDir())
+}
+
+func merge(w io.Writer, format string, inputs []string, expected utils.Generator, window int, dir string) (report MergeReport, err error) {
+	sorter := newRowSorter(window, dir)
+	defer func() {
+		err = errors.Join(err, sorter.Close())
+	}()
+
+	for _, path := range inputs {
+		if err := readRows(sorter, format, path); err != nil {
+			return report, err
+		}
+	}
+
+	var gaps *gapFinder
+	if expected != nil {
+		gaps = newGapFinder(expected, &report)
+		defer gaps.stop()
+	}
+
+	// equal addresses come in the order of the inputs, the best status first
+	out := bufio.NewWriter(w)
+	var last netip.Addr
+	for {
+		row, err := sorter.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return report, err
+		}
+
+		if report.Rows > 0 && last == row.IP {
+			report.Duplicates++
+			if n := len(report.Overlaps); n == 0 || report.Overlaps[n-1].End != row.IP {
+				report.Overlaps = appendAdjacent(report.Overlaps, row.IP)
+			}
+			continue
+		}
+		last = row.IP
+
+		if gaps != nil {
+			gaps.row(row.IP)
+		}
+		if _, err := out.Write(row.Line); err != nil {
+			return report, err
+		}
+		report.Rows++
+	}
+
+	if gaps != nil {
+		gaps.finish()
+	}
+	return report, out.Flush()
+}
+
+// readRows adds the rows of the output at path to sorter
+func readRows(sorter *rowSorter, format, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	//nolint:errcheck
+	defer file.Close()
+
+	switch format {
+	case FormatCSV:
+		return readCSVRows(sorter, path, file)
+	case FormatJSONL:
+		return readJSONLRows(sorter, path, file)
+	default:
+		return fmt.Errorf("cannot merge outputs of format %q, must be %s or %s", format, FormatCSV, FormatJSONL)
+	}
+}
+
+func readCSVRows(sorter *rowSorter, path string, r io.Reader) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		line, _ := cr.FieldPos(0)
+		if len(record) < 2 {
+			return fmt.Errorf("%s:%d: not a result row", path, line)
+		}
+		ip, err := netip.ParseAddr(record[0])
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+
+		buf.Reset()
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+		cw.Flush()
+		if err := sorter.Add(mergeRow{IP: ip, Status: resolver.Status(record[1]), Line: bytes.Clone(buf.Bytes())}); err != nil {
+			return err
+		}
+	}
+}
+
+func readJSONLRows(sorter *rowSorter, path string, r io.Reader) error {
+	lines := bufio.NewScanner(r)
+	lines.Buffer(nil, 1<<20)
+
+	for line := 1; lines.Scan(); line++ {
+		data := bytes.TrimSpace(lines.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		var result jsonResult
+		if err := json.Unmarshal(data, &result); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		ip, err := netip.ParseAddr(result.IP)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if err := sorter.Add(mergeRow{IP: ip, Status: result.Status, Line: append(bytes.Clone(data), '\n')}); err != nil {
+			return err
+		}
+	}
+	if err := lines.Err(); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// statusRank orders the rows of an address, lower is better: a name, no
+// name, then a failed lookup
+func statusRank(status resolver.Status) int {
+	switch status {
+	case resolver.StatusOK:
+		return 0
+	case resolver.StatusNXDomain:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// gapFinder walks the expected addresses along the sorted rows, expected
+// addresses without a row are gaps and rows matching no expected address
+// are unexpected
+type gapFinder struct {
+	report *MergeReport
+	next   func() (netip.Addr, bool)
+	stop   func()
+	ip     netip.Addr
+	ok     bool
+	// open is set while the last gap may grow
+	open bool
+}
+
+func newGapFinder(expected utils.Generator, report *MergeReport) *gapFinder {
+	g := &gapFinder{report: report}
+	g.next, g.stop = iter.Pull(expected.All())
+	g.ip, g.ok = g.next()
+	return g
+}
+
+// row matches the address of the next row, in ascending order
+func (g *gapFinder) row(ip netip.Addr) {
+	for g.ok && g.ip.Less(ip) {
+		g.missing()
+	}
+
+	if g.ok && g.ip == ip {
+		g.ip, g.ok = g.next()
+		g.open = false
+		return
+	}
+	g.report.Unexpected++
+}
+
+// finish reports the expected addresses after the last row
+func (g *gapFinder) finish() {
+	for g.ok {
+		g.missing()
+	}
+}
+
+// missing reports the current expected address as missing and moves to the next one
+func (g *gapFinder) missing() {
+	g.report.Missing++
+	if g.open {
+		g.report.Gaps[len(g.report.Gaps)-1].End = g.ip
+	} else {
+		g.report.Gaps = append(g.report.Gaps, utils.Range{Start: g.ip, End: g.ip})
+		g.open = true
+	}
+	g.ip, g.ok = g.next()
+}
+
+// appendAdjacent adds ip to the sorted ranges rs, extending the last range
+// when ip follows it
+func appendAdjacent(rs []utils.Range, ip netip.Addr) []utils.Range {
+	if n := len(rs); n > 0 && rs[n-1].End.Next() == ip {
+		rs[n-1].End = ip
+		return rs
+	}
+	return append(rs, utils.Range{Start: ip, End: ip})
+}
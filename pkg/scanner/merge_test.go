@@ -0,0 +1,198 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/amine7536/reverse-scan/pkg/utils"
+)
+
+// writeInputs writes each content to its own file and returns their paths
+func writeInputs(t *testing.T, contents ...string) []string {
+	t.Helper()
+	dir := t.TempDir()
+
+	paths := make([]string, len(contents))
+	for i, content := range contents {
+		paths[i] = filepath.Join(dir, "shard"+string(rune('a'+i)))
+		if err := os.WriteFile(paths[i], []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return paths
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name           string
+		format         string
+		inputs         []string
+		expected       utils.Generator
+		want           string
+		wantOverlaps   []string
+		wantGaps       []string
+		wantDuplicates uint64
+		wantMissing    uint64
+		wantUnexpected uint64
+	}{
+		{
+			name:   "disjoint shards",
+			format: FormatCSV,
+			inputs: []string{
+				"192.0.2.3,ok,1,host-3.\n192.0.2.1,nxdomain,1\n",
+				"192.0.2.10,ok,1,host-10.,\"quoted, name.\"\n192.0.2.2,ok,1,host-2.\n",
+			},
+			expected: testRange(t, "192.0.2.1", "192.0.2.3"),
+			want:     "192.0.2.1,nxdomain,1\n192.0.2.2,ok,1,host-2.\n192.0.2.3,ok,1,host-3.\n192.0.2.10,ok,1,host-10.,\"quoted, name.\"\n",
+			// 192.0.2.10 was not a target
+			wantUnexpected: 1,
+		},
+		{
+			name:   "overlapping shards keep the successful lookup",
+			format: FormatCSV,
+			inputs: []string{
+				"192.0.2.1,timeout,3\n192.0.2.2,ok,1,host-2.\n192.0.2.3,ok,1,host-3.\n",
+				"192.0.2.2,servfail,3\n192.0.2.1,ok,2,host-1.\n192.0.2.3,nxdomain,1\n",
+			},
+			want:           "192.0.2.1,ok,2,host-1.\n192.0.2.2,ok,1,host-2.\n192.0.2.3,ok,1,host-3.\n",
+			wantOverlaps:   []string{"192.0.2.1-192.0.2.3"},
+			wantDuplicates: 3,
+		},
+		{
+			name:   "missing shard",
+			format: FormatCSV,
+			inputs: []string{
+				"192.0.2.1,ok,1,host-1.\n192.0.2.2,ok,1,host-2.\n",
+				"192.0.2.6,ok,1,host-6.\n192.0.2.5,ok,1,host-5.\n192.0.2.8,ok,1,host-8.\n",
+			},
+			expected:    testRange(t, "192.0.2.1", "192.0.2.10"),
+			want:        "192.0.2.1,ok,1,host-1.\n192.0.2.2,ok,1,host-2.\n192.0.2.5,ok,1,host-5.\n192.0.2.6,ok,1,host-6.\n192.0.2.8,ok,1,host-8.\n",
+			wantGaps:    []string{"192.0.2.3-192.0.2.4", "192.0.2.7-192.0.2.7", "192.0.2.9-192.0.2.10"},
+			wantMissing: 5,
+		},
+		{
+			name:   "jsonl",
+			format: FormatJSONL,
+			inputs: []string{
+				`{"ip":"2001:db8::2","status":"ok","names":["b."]}` + "\n\n",
+				`{"ip":"192.0.2.1","status":"timeout","names":[]}` + "\n" + `{"ip":"192.0.2.1","status":"nxdomain","names":[]}` + "\n",
+			},
+			want:           `{"ip":"192.0.2.1","status":"nxdomain","names":[]}` + "\n" + `{"ip":"2001:db8::2","status":"ok","names":["b."]}` + "\n",
+			wantOverlaps:   []string{"192.0.2.1-192.0.2.1"},
+			wantDuplicates: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			report, err := Merge(&out, tt.format, writeInputs(t, tt.inputs...), tt.expected)
+			if err != nil {
+				t.Fatalf("Merge() unexpected error = %v", err)
+			}
+
+			if out.String() != tt.want {
+				t.Errorf("Merge() wrote %q, want %q", out.String(), tt.want)
+			}
+			if want := uint64(strings.Count(tt.want, "\n")); report.Rows != want {
+				t.Errorf("MergeReport.Rows = %v, want %v", report.Rows, want)
+			}
+			if got := rangeStrings(report.Overlaps); !slices.Equal(got, tt.wantOverlaps) {
+				t.Errorf("MergeReport.Overlaps = %v, want %v", got, tt.wantOverlaps)
+			}
+			if got := rangeStrings(report.Gaps); !slices.Equal(got, tt.wantGaps) {
+				t.Errorf("MergeReport.Gaps = %v, want %v", got, tt.wantGaps)
+			}
+			if report.Duplicates != tt.wantDuplicates {
+				t.Errorf("MergeReport.Duplicates = %v, want %v", report.Duplicates, tt.wantDuplicates)
+			}
+			if report.Missing != tt.wantMissing {
+				t.Errorf("MergeReport.Missing = %v, want %v", report.Missing, tt.wantMissing)
+			}
+			if report.Unexpected != tt.wantUnexpected {
+				t.Errorf("MergeReport.Unexpected = %v, want %v", report.Unexpected, tt.wantUnexpected)
+			}
+		})
+	}
+}
+
+func TestMergeErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		input  string
+	}{
+		{name: "unknown format", format: "xml", input: "192.0.2.1,ok,1\n"},
+		{name: "not an IP", format: FormatCSV, input: "192.0.2.1,ok,1\nhost,ok,1\n"},
+		{name: "missing status", format: FormatCSV, input: "192.0.2.1\n"},
+		{name: "invalid JSON", format: FormatJSONL, input: "{\"ip\":\n"},
+		{name: "CSV as JSONL", format: FormatJSONL, input: "192.0.2.1,ok,1\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			if _, err := Merge(&out, tt.format, writeInputs(t, tt.input), nil); err == nil {
+				t.Errorf("Merge() expected error")
+			}
+		})
+	}
+
+	var out strings.Builder
+	if _, err := Merge(&out, FormatCSV, []string{filepath.Join(t.TempDir(), "missing.csv")}, nil); err == nil {
+		t.Errorf("Merge() of a missing file expected error")
+	}
+}
+
+// TestMergeShards merges the outputs of a sharded scan back into the output of the whole scan
+func TestMergeShards(t *testing.T) {
+	hosts := testRange(t, "192.0.2.0", "192.0.2.99")
+	dir := t.TempDir()
+
+	var paths []string
+	for i := range uint64(3) {
+		shard, err := utils.NewShard(hosts, i, 3)
+		if err != nil {
+			t.Fatalf("NewShard() unexpected error = %v", err)
+		}
+
+		path := filepath.Join(dir, "shard"+string(rune('a'+i))+".csv")
+		s, err := New(WithHosts(shard), WithResolver(fakeResolver{}), WithWorkers(8), WithOutput(path))
+		if err != nil {
+			t.Fatalf("New() unexpected error = %v", err)
+		}
+		if _, err := s.Run(t.Context()); err != nil {
+			t.Fatalf("Run() unexpected error = %v", err)
+		}
+		paths = append(paths, path)
+	}
+
+	var out strings.Builder
+	report, err := Merge(&out, FormatCSV, paths, hosts)
+	if err != nil {
+		t.Fatalf("Merge() unexpected error = %v", err)
+	}
+	if report.Rows != 100 || report.Duplicates != 0 || report.Missing != 0 || report.Unexpected != 0 {
+		t.Errorf("Merge() report = %+v, want 100 rows without gaps or overlaps", report)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	var i int
+	for ip := range hosts.All() {
+		if want := ip.String() + ",ok,1,host-" + strings.Split(ip.String(), ".")[3] + "."; lines[i] != want {
+			t.Errorf("Merge() row %d = %q, want %q", i, lines[i], want)
+		}
+		i++
+	}
+}
+
+func rangeStrings(rs []utils.Range) []string {
+	var s []string
+	for _, r := range rs {
+		s = append(s, r.String())
+	}
+	return s
+}
@@ -0,0 +1,93 @@
+package scanner
+
+import (
+	"cmp"
+	"io"
+	"slices"
+)
+
+// rowSorter sorts the rows of the outputs merged by Merge. Up to window rows
+// are sorted in memory, beyond that they are spilled to a temporary file in
+// sorted runs, each run keeping a single row in memory.
+type rowSorter struct {
+	rows   []mergeRow
+	runs   *sortedRuns[mergeRow]
+	window int
+	seq    uint64
+	// merging is set once the rows are read back
+	merging bool
+}
+
+func newRowSorter(window int, dir string) *rowSorter {
+	return &rowSorter{
+		runs: newSortedRuns(dir, "reverse-scan-merge-*", func(a, b mergeRow) bool {
+			return compareRows(a, b) < 0
+		}),
+		window: window,
+	}
+}
+
+// compareRows orders the rows by IP, the best status first, equal rows
+// keep the order they were added in
+func compareRows(a, b mergeRow) int {
+	if c := a.IP.Compare(b.IP); c != 0 {
+		return c
+	}
+	if c := statusRank(a.Status) - statusRank(b.Status); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.Seq, b.Seq)
+}
+
+// Add buffers row, spilling the buffered rows once the window is full
+func (s *rowSorter) Add(row mergeRow) error {
+	row.Seq = s.seq
+	s.seq++
+	s.rows = append(s.rows, row)
+	if len(s.rows) >= s.window {
+		return s.spillRows()
+	}
+	return nil
+}
+
+// Next returns the next row in order, io.EOF after the last one
+func (s *rowSorter) Next() (mergeRow, error) {
+	if !s.merging {
+		s.merging = true
+		// rows that all fit in memory are not spilled
+		slices.SortFunc(s.rows, compareRows)
+		if s.runs.Len() > 0 && len(s.rows) > 0 {
+			if err := s.spillRows(); err != nil {
+				return mergeRow{}, err
+			}
+		}
+	}
+
+	if len(s.rows) > 0 {
+		row := s.rows[0]
+		s.rows = s.rows[1:]
+		return row, nil
+	}
+
+	row, ok := s.runs.Peek()
+	if !ok {
+		return mergeRow{}, io.EOF
+	}
+	return row, s.runs.Next()
+}
+
+// Close removes the spill file
+func (s *rowSorter) Close() error {
+	return s.runs.Close()
+}
+
+// spillRows writes the rows buffered in memory to a new run
+func (s *rowSorter) spillRows() error {
+	slices.SortFunc(s.rows, compareRows)
+	if err := s.runs.Spill(slices.Values(s.rows)); err != nil {
+		return err
+	}
+	clear(s.rows)
+	s.rows = s.rows[:0]
+	return nil
+}
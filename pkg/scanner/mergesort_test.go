@@ -0,0 +1,132 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/netip"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/amine7536/reverse-scan/pkg/resolver"
+)
+
+func TestRowSorter(t *testing.T) {
+	tests := []struct {
+		name     string
+		window   int
+		wantRuns int
+	}{
+		{name: "in memory", window: 1000},
+		{name: "spilled", window: 10, wantRuns: 30},
+		{name: "single row window", window: 1, wantRuns: 300},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s := newRowSorter(tt.window, dir)
+
+			// every address has a failed lookup, a success and no name, in random order
+			var rows []mergeRow
+			for i := range 100 {
+				ip := netip.AddrFrom4([4]byte{192, 0, 2, byte(i)})
+				for _, status := range []resolver.Status{resolver.StatusTimeout, resolver.StatusOK, resolver.StatusNXDomain} {
+					rows = append(rows, mergeRow{IP: ip, Status: status, Line: []byte(ip.String() + "," + string(status) + "\n")})
+				}
+			}
+			rand.New(rand.NewPCG(1, 2)).Shuffle(len(rows), func(i, j int) { rows[i], rows[j] = rows[j], rows[i] })
+
+			for _, row := range rows {
+				if err := s.Add(row); err != nil {
+					t.Fatalf("Add() unexpected error = %v", err)
+				}
+				if len(s.rows) > tt.window {
+					t.Fatalf("%d rows in memory, want at most %d", len(s.rows), tt.window)
+				}
+			}
+
+			if s.runs.Runs() != tt.wantRuns {
+				t.Errorf("%d runs spilled, want %d", s.runs.Runs(), tt.wantRuns)
+			}
+
+			var got []mergeRow
+			for {
+				row, err := s.Next()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					t.Fatalf("Next() unexpected error = %v", err)
+				}
+				got = append(got, row)
+
+				// besides a row per run, at most a window of rows waits in memory
+				if len(s.rows) > tt.window {
+					t.Fatalf("%d rows in memory besides the %d runs, want at most %d", len(s.rows), s.runs.Runs(), tt.window)
+				}
+			}
+
+			if len(got) != len(rows) {
+				t.Fatalf("Next() returned %d rows, want %d", len(got), len(rows))
+			}
+			order := []resolver.Status{resolver.StatusOK, resolver.StatusNXDomain, resolver.StatusTimeout}
+			for i, row := range got {
+				ip, status := netip.AddrFrom4([4]byte{192, 0, 2, byte(i / 3)}), order[i%3]
+				if row.IP != ip || row.Status != status || string(row.Line) != fmt.Sprintf("%v,%v\n", ip, status) {
+					t.Errorf("Next() row %d = %v %v %q, want %v %v", i, row.IP, row.Status, row.Line, ip, status)
+				}
+			}
+
+			if err := s.Close(); err != nil {
+				t.Errorf("Close() unexpected error = %v", err)
+			}
+			if files, _ := os.ReadDir(dir); len(files) != 0 {
+				t.Errorf("Close() left %v in the spill directory", files)
+			}
+		})
+	}
+}
+
+// TestMergeBeyondWindow merges inputs holding many more rows than the window,
+// the output and the report are the ones of a merge in memory
+func TestMergeBeyondWindow(t *testing.T) {
+	var inputs [3]strings.Builder
+	for i := range 3000 {
+		ip := netip.AddrFrom4([4]byte{10, 0, byte(i / 256), byte(i)})
+		// 10.0.0.0 to 10.0.1.243 are in two inputs, one of them failed
+		fmt.Fprintf(&inputs[i%3], "%v,ok,1,host-%d.\n", ip, i)
+		if i < 500 {
+			fmt.Fprintf(&inputs[(i+1)%3], "%v,timeout,3\n", ip)
+		}
+	}
+	paths := writeInputs(t, inputs[0].String(), inputs[1].String(), inputs[2].String())
+	expected := testRange(t, "10.0.0.0", "10.0.15.255")
+
+	var want strings.Builder
+	wantReport, err := merge(&want, FormatCSV, paths, expected, 10000, t.TempDir())
+	if err != nil {
+		t.Fatalf("merge() unexpected error = %v", err)
+	}
+	if wantReport.Rows != 3000 || wantReport.Duplicates != 500 || wantReport.Missing != 4096-3000 {
+		t.Fatalf("merge() report = %+v, want 3000 rows, 500 duplicates and 1096 missing", wantReport)
+	}
+
+	dir := t.TempDir()
+	var got strings.Builder
+	report, err := merge(&got, FormatCSV, paths, expected, 64, dir)
+	if err != nil {
+		t.Fatalf("merge() unexpected error = %v", err)
+	}
+	if got.String() != want.String() {
+		t.Errorf("merge() beyond the window wrote another output than in memory")
+	}
+	if fmt.Sprint(report) != fmt.Sprint(wantReport) {
+		t.Errorf("merge() beyond the window report = %+v, want %+v", report, wantReport)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Errorf("merge() left %v in the spill directory", files)
+	}
+}
@@ -0,0 +1,197 @@
+package scanner
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/amine7536/reverse-scan/pkg/config"
+	"github.com/amine7536/reverse-scan/pkg/queue"
+	"github.com/amine7536/reverse-scan/pkg/resolver"
+	"github.com/amine7536/reverse-scan/pkg/utils"
+)
+
+// Option configures a Scanner
+type Option func(*Scanner) error
+
+// WithHosts sets the addresses to scan
+func WithHosts(hosts utils.Generator) Option {
+	return func(s *Scanner) error {
+		s.hosts = hosts
+		return nil
+	}
+}
+
+// WithWorkers sets the number of concurrent lookups
+func WithWorkers(n int) Option {
+	return func(s *Scanner) error {
+		if n < 1 {
+			return fmt.Errorf("invalid number of workers %d: must be at least 1", n)
+		}
+		s.workers = n
+		return nil
+	}
+}
+
+// WithAdaptiveWorkers tunes the number of concurrent lookups while scanning,
+// starting with minWorkers and backing off when the resolvers slow down or
+// fail, it overrides WithWorkers
+func WithAdaptiveWorkers(minWorkers, maxWorkers int) Option {
+	return func(s *Scanner) error {
+		if minWorkers < 1 || maxWorkers < minWorkers {
+			return fmt.Errorf("invalid number of workers %d to %d: must be at least 1 and increasing", minWorkers, maxWorkers)
+		}
+		s.workersMin = minWorkers
+		s.workersMax = maxWorkers
+		return nil
+	}
+}
+
+// WithResolver sets the resolver of the lookups, the system resolver by default
+func WithResolver(r resolver.Resolver) Option {
+	return func(s *Scanner) error {
+		s.resolver = r
+		return nil
+	}
+}
+
+// WithTimeout bounds every lookup, no limit when zero
+func WithTimeout(d time.Duration) Option {
+	return func(s *Scanner) error {
+		s.timeout = d
+		return nil
+	}
+}
+
+// WithRetry sets which failed lookups are tried again
+func WithRetry(p resolver.RetryPolicy) Option {
+	return func(s *Scanner) error {
+		s.retry = p
+		return nil
+	}
+}
+
+// WithRateLimiter caps the query rate of all workers
+func WithRateLimiter(l *queue.RateLimiter) Option {
+	return func(s *Scanner) error {
+		s.limiter = l
+		return nil
+	}
+}
+
+// WithOutput sets the output file, written by the sink
+func WithOutput(path string) Option {
+	return func(s *Scanner) error {
+		s.output = path
+		return nil
+	}
+}
+
+// WithSink sets the sink receiving the results, a CSV sink by default
+func WithSink(sink Sink) Option {
+	return func(s *Scanner) error {
+		s.sink = sink
+		return nil
+	}
+}
+
+// WithSorted writes the results in the order of the addresses instead of
+// the order their lookups complete. Up to window results wait in memory for
+// a slower lookup, the next ones are spilled to a temporary file.
+func WithSorted(window int) Option {
+	return func(s *Scanner) error {
+		if window < 1 {
+			return fmt.Errorf("invalid sort window %d: must be at least 1", window)
+		}
+		s.sortWindow = window
+		return nil
+	}
+}
+
+// WithCheckpoint records the progress of the scan in path every interval
+func WithCheckpoint(path string, interval time.Duration) Option {
+	return func(s *Scanner) error {
+		if interval <= 0 {
+			return fmt.Errorf("invalid checkpoint interval %v: must be positive", interval)
+		}
+		s.checkpoint = path
+		s.checkpointInterval = interval
+		return nil
+	}
+}
+
+// WithResume resumes the scan recorded in the checkpoint, appending to the output
+func WithResume() Option {
+	return func(s *Scanner) error {
+		s.resume = true
+		return nil
+	}
+}
+
+// WithResults streams every result to fn, called from the goroutine running
+// the scan once the result is written
+func WithResults(fn func(Result)) Option {
+	return func(s *Scanner) error {
+		s.onResult = fn
+		return nil
+	}
+}
+
+// WithProgress calls fn after every result with the number of addresses
+// looked up so far and the number this run will look up
+func WithProgress(fn func(done, total uint64)) Option {
+	return func(s *Scanner) error {
+		s.onProgress = fn
+		return nil
+	}
+}
+
+// WithLogger sets the logger of warnings, rate adjustments, resizes and recovered panics, nothing is logged by default
+func WithLogger(l *log.Logger) Option {
+	return func(s *Scanner) error {
+		s.logger = l
+		return nil
+	}
+}
+
+// WithConfig applies the settings of the command line configuration
+func WithConfig(c *config.Config) Option {
+	return func(s *Scanner) error {
+		sink, err := NewSink(c.Format)
+		if err != nil {
+			return err
+		}
+
+		s.hosts = c.Hosts
+		s.workers = c.WORKERS
+		s.workersMin = c.WorkersMin
+		s.workersMax = c.WorkersMax
+		s.timeout = c.Timeout
+		s.retry = c.Retry
+		s.output = c.CSV
+		s.sink = sink
+		s.checkpoint = c.Checkpoint
+		s.checkpointInterval = c.CheckpointInterval
+		s.resume = c.Resume
+		if c.Sorted {
+			s.sortWindow = DefaultSortWindow
+		}
+
+		if c.Rate > 0 {
+			s.limiter = queue.NewRateLimiter(c.Rate, c.Burst, c.AdaptiveRate)
+			s.limiter.OnAdjust = func(rate, failureRatio float64) {
+				s.logger.Printf("Adjusted rate to %.1f queries/s (%.1f%% refused or timed out)", rate, 100*failureRatio)
+			}
+		}
+
+		if len(c.Resolvers) > 0 {
+			client, err := resolver.NewClient(c.Resolvers, c.TCP)
+			if err != nil {
+				return err
+			}
+			client.Timeout = c.Timeout
+			s.resolver = client
+		}
+		return nil
+	}
+}
@@ -0,0 +1,107 @@
+package scanner
+
+import (
+	"slices"
+)
+
+// DefaultSortWindow is the number of results a sorted scan keeps in memory
+// while waiting for a slower lookup, the next ones are spilled to disk
+const DefaultSortWindow = 1 << 16
+
+// reorderBuffer releases the results in the order of their sequence numbers.
+// Up to window results wait in memory for the next one to complete, beyond
+// that they are spilled to a temporary file in sorted runs, each run keeping
+// a single result in memory.
+type reorderBuffer struct {
+	pending map[uint64]Result
+	runs    *sortedRuns[spilled]
+	// skip reports the sequence numbers that will never complete, the ones
+	// done by a previous run
+	skip   func(seq uint64) bool
+	window int
+	next   uint64
+}
+
+// spilled is the encoding of a result waiting on disk
+type spilled struct {
+	Seq    uint64
+	Result Result
+}
+
+func newReorderBuffer(window int, dir string, skip func(seq uint64) bool) *reorderBuffer {
+	return &reorderBuffer{
+		pending: make(map[uint64]Result),
+		runs:    newSortedRuns(dir, "reverse-scan-sort-*", func(a, b spilled) bool { return a.Seq < b.Seq }),
+		skip:    skip,
+		window:  window,
+	}
+}
+
+// Add buffers the result of seq and passes emit every result that is next in order
+func (b *reorderBuffer) Add(seq uint64, result Result, emit func(seq uint64, result Result) error) error {
+	b.pending[seq] = result
+
+	for {
+		for b.skip(b.next) {
+			b.next++
+		}
+
+		if result, ok := b.pending[b.next]; ok {
+			delete(b.pending, b.next)
+			if err := emit(b.next, result); err != nil {
+				return err
+			}
+			b.next++
+			continue
+		}
+
+		if head, ok := b.runs.Peek(); ok && head.Seq == b.next {
+			if err := emit(b.next, head.Result); err != nil {
+				return err
+			}
+			if err := b.runs.Next(); err != nil {
+				return err
+			}
+			b.next++
+			continue
+		}
+		break
+	}
+
+	if len(b.pending) > b.window {
+		return b.spillPending()
+	}
+	return nil
+}
+
+// Len returns the number of results waiting, in memory or on disk
+func (b *reorderBuffer) Len() int {
+	return len(b.pending) + b.runs.Len()
+}
+
+// Close removes the spill file, the results still waiting are dropped
+func (b *reorderBuffer) Close() error {
+	return b.runs.Close()
+}
+
+// spillPending writes the results waiting in memory to a new run
+func (b *reorderBuffer) spillPending() error {
+	seqs := make([]uint64, 0, len(b.pending))
+	for seq := range b.pending {
+		seqs = append(seqs, seq)
+	}
+	slices.Sort(seqs)
+
+	err := b.runs.Spill(func(yield func(spilled) bool) {
+		for _, seq := range seqs {
+			if !yield(spilled{Seq: seq, Result: b.pending[seq]}) {
+				return
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	clear(b.pending)
+	return nil
+}
@@ -0,0 +1,96 @@
+package scanner
+
+import (
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestReorderBuffer(t *testing.T) {
+	tests := []struct {
+		name   string
+		window int
+		skip   map[uint64]bool
+	}{
+		{name: "in memory", window: 1000},
+		{name: "spilled", window: 3},
+		{name: "single result window", window: 1},
+		{name: "resumed", window: 5, skip: map[uint64]bool{0: true, 1: true, 7: true, 50: true, 99: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			b := newReorderBuffer(tt.window, dir, func(seq uint64) bool { return tt.skip[seq] })
+
+			var seqs, want []uint64
+			for seq := range uint64(100) {
+				if !tt.skip[seq] {
+					seqs = append(seqs, seq)
+					want = append(want, seq)
+				}
+			}
+			rand.New(rand.NewPCG(1, 2)).Shuffle(len(seqs), func(i, j int) { seqs[i], seqs[j] = seqs[j], seqs[i] })
+
+			var got []uint64
+			emit := func(seq uint64, result Result) error {
+				if result.IP != strconv.FormatUint(seq, 10) {
+					t.Errorf("emit(%d) got the result of %v", seq, result.IP)
+				}
+				got = append(got, seq)
+				return nil
+			}
+			for _, seq := range seqs {
+				if err := b.Add(seq, Result{IP: strconv.FormatUint(seq, 10), Names: []string{"a.", "b."}}, emit); err != nil {
+					t.Fatalf("Add() unexpected error = %v", err)
+				}
+			}
+
+			if !slices.Equal(got, want) {
+				t.Errorf("emitted %v, want %v", got, want)
+			}
+			if b.Len() != 0 {
+				t.Errorf("Len() = %v after the last result, want 0", b.Len())
+			}
+			if err := b.Close(); err != nil {
+				t.Errorf("Close() unexpected error = %v", err)
+			}
+			if files, _ := os.ReadDir(dir); len(files) != 0 {
+				t.Errorf("Close() left %v in the spill directory", files)
+			}
+		})
+	}
+}
+
+func TestReorderBufferSpillsBeyondWindow(t *testing.T) {
+	dir := t.TempDir()
+	b := newReorderBuffer(10, dir, func(uint64) bool { return false })
+
+	// seq 0 never completes, everything else waits for it
+	emit := func(seq uint64, _ Result) error {
+		t.Errorf("emit(%d) before seq 0", seq)
+		return nil
+	}
+	for seq := uint64(1); seq <= 100; seq++ {
+		if err := b.Add(seq, Result{IP: "192.0.2.1"}, emit); err != nil {
+			t.Fatalf("Add() unexpected error = %v", err)
+		}
+		if len(b.pending) > 10 {
+			t.Fatalf("%d results in memory, want at most 10", len(b.pending))
+		}
+	}
+	if b.Len() != 100 {
+		t.Errorf("Len() = %v, want 100", b.Len())
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil || len(files) != 1 {
+		t.Errorf("spill files = %v, want one", files)
+	}
+	if err := b.Close(); err != nil {
+		t.Errorf("Close() unexpected error = %v", err)
+	}
+}
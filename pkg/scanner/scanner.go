@@ -2,72 +2,474 @@
 package scanner
 
 import (
-	"encoding/csv"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"os"
+	"strings"
+	"time"
 
-	"github.com/gosuri/uiprogress"
-
-	"github.com/amine7536/reverse-scan/pkg/config"
+	"github.com/amine7536/reverse-scan/pkg/checkpoint"
 	"github.com/amine7536/reverse-scan/pkg/queue"
+	"github.com/amine7536/reverse-scan/pkg/resolver"
 	"github.com/amine7536/reverse-scan/pkg/utils"
 )
 
-// Start scanner
-func Start(c *config.Config) {
-	hosts, err := utils.GetHosts(c.CIDR)
-	if err != nil {
-		log.Fatalf("Failed to get hosts: %v", err)
+// Scanner looks up the names of a set of addresses
+type Scanner struct {
+	hosts      utils.Generator
+	resolver   resolver.Resolver
+	sink       Sink
+	limiter    *queue.RateLimiter
+	logger     *log.Logger
+	onResult   func(Result)
+	onProgress func(done, total uint64)
+	output     string
+	checkpoint string
+	retry      resolver.RetryPolicy
+	workers    int
+	// workersMin and workersMax bound the number of workers tuned while
+	// scanning, zero when the number is fixed
+	workersMin int
+	workersMax int
+	// sortWindow is the number of results waiting in memory to be written in
+	// order, the results are written as they come when zero
+	sortWindow int
+	timeout    time.Duration
+	// checkpointInterval is the time between two checkpoints
+	checkpointInterval time.Duration
+	resume             bool
+}
+
+// Summary describes a completed or interrupted scan
+type Summary struct {
+	// Statuses counts the lookups of this run per status
+	Statuses map[resolver.Status]uint64
+	// Total is the number of addresses of the scan
+	Total uint64
+	// Resumed is the number of addresses completed by previous runs
+	Resumed uint64
+	// Scanned is the number of addresses looked up by this run whose result
+	// was written
+	Scanned uint64
+	// Panics is the number of lookups of this run that panicked, their
+	// results have the panic status
+	Panics   uint64
+	Duration time.Duration
+}
+
+// Done returns the number of addresses completed, by this run or previous ones
+func (s Summary) Done() uint64 {
+	return s.Resumed + s.Scanned
+}
+
+// Complete reports whether every address of the scan was looked up
+func (s Summary) Complete() bool {
+	return s.Done() == s.Total
+}
+
+// FormatStatuses renders the per status counters in a stable order
+func (s Summary) FormatStatuses() string {
+	all := []resolver.Status{
+		resolver.StatusOK,
+		resolver.StatusNXDomain,
+		resolver.StatusServFail,
+		resolver.StatusRefused,
+		resolver.StatusTimeout,
+		resolver.StatusOther,
+		resolver.StatusPanic,
+	}
+
+	parts := make([]string, 0, len(all))
+	for _, status := range all {
+		parts = append(parts, fmt.Sprintf("%s=%d", status, s.Statuses[status]))
 	}
+	return strings.Join(parts, " ")
+}
 
-	results := make(chan queue.Job)
+// New returns a scanner of the addresses set with WithHosts
+func New(opts ...Option) (*Scanner, error) {
+	s := &Scanner{
+		resolver: resolver.System{},
+		workers:  1,
+		logger:   log.New(io.Discard, "", 0),
+	}
 
-	log.Printf("Resolving from %v to %v", c.StartIP, c.EndIP)
-	log.Printf("Calculated CIDR is %s", c.CIDR)
-	log.Printf("Number of IPs to scan: %v", len(hosts))
-	log.Printf("Starting %v Workers", c.WORKERS)
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
 
-	file, err := os.Create(c.CSV)
+	if s.hosts == nil {
+		return nil, errors.New("no hosts to scan")
+	}
+
+	if s.resume && s.checkpoint == "" {
+		return nil, errors.New("cannot resume without a checkpoint")
+	}
+
+	// a checkpoint records the scan it belongs to by the ID of its hosts
+	if _, ok := utils.IDOf(s.hosts); s.checkpoint != "" && !ok {
+		return nil, fmt.Errorf("cannot checkpoint a scan of %T, it has no ID", s.hosts)
+	}
+
+	if s.sink == nil && s.output != "" {
+		s.sink = &csvSink{}
+	}
+
+	return s, nil
+}
+
+// Run scans the addresses, it returns once every address was looked up or
+// ctx is done. When ctx is done no new lookup is started, the results of the
+// in-flight ones are written then Run returns ctx's error with the summary
+// of the interrupted scan. A Scanner runs once.
+func (s *Scanner) Run(ctx context.Context) (Summary, error) {
+	started := time.Now()
+	summary := Summary{
+		Total:    s.hosts.Size(),
+		Statuses: make(map[resolver.Status]uint64),
+	}
+
+	file, ckpt, err := s.openOutput(summary.Total)
 	if err != nil {
-		log.Fatalf("Failed to create output file: %v", err)
+		return summary, err
+	}
+
+	// The producer skips what the checkpoint had completed, ckpt itself keeps changing
+	resumed := ckpt.Clone()
+	summary.Resumed = resumed.Count()
+	if s.resume {
+		s.logger.Printf("Resuming scan, %v IPs already done", summary.Resumed)
+	}
+
+	if s.sink != nil {
+		var w io.Writer = io.Discard
+		if file != nil {
+			w = file
+		}
+		if err := s.sink.Open(w); err != nil {
+			closeFile(file)
+			return summary, fmt.Errorf("open output: %w", err)
+		}
+	}
+
+	// In-flight lookups are not canceled with ctx, they are bounded by the
+	// lookup timeout, but they are not retried once ctx is done
+	workCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+
+	lookup := queue.Lookup{Resolver: s.resolver, Timeout: s.timeout, Retry: s.retry, Limiter: s.limiter, Stop: ctx.Done()}
+	workers := s.workers
+	var dispatch *queue.Dispatcher[queue.Job, queue.Job]
+	if s.workersMax > 0 {
+		workers = s.workersMin
+		lookup.Autoscaler = queue.NewAutoscaler(s.workersMin, s.workersMax, func(n int) {
+			dispatch.Resize(n)
+		})
+		lookup.Autoscaler.OnResize = func(workers, old int, reason string) {
+			s.logger.Printf("Resized from %d to %d workers (%s)", old, workers, reason)
+		}
+	}
+
+	results := make(chan queue.Result[queue.Job, queue.Job])
+	dispatch = queue.NewDispatcher(workers, lookup.Handle, results)
+	dispatch.Run(workCtx)
+
+	// Send Jobs to Dispatch while results are being read, until ctx is done.
+	// The bounded job queue holds the producer back while the workers are busy.
+	go func() {
+		defer dispatch.Close()
+		var next uint64
+		for ip := range s.hosts.All() {
+			seq := next
+			next++
+			if resumed.IsDone(seq) {
+				continue
+			}
+
+			select {
+			case dispatch.JobQueue <- queue.Job{IP: ip.String(), Seq: seq}:
+			case <-ctx.Done():
+				// the queued jobs are not started, a resumed scan looks them up
+				discard(dispatch.JobQueue)
+				return
+			case <-workCtx.Done():
+				return
+			}
+		}
+	}()
+
+	// every result is in once the workers are done with the queued jobs
+	go func() {
+		dispatch.Wait()
+		close(results)
+	}()
+
+	var tick <-chan time.Time
+	if s.checkpoint != "" {
+		ticker := time.NewTicker(s.checkpointInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	// emit writes a result, the address is done once its result is written
+	emit := func(seq uint64, result Result) error {
+		if s.sink != nil {
+			if err := s.sink.Write(result); err != nil {
+				return err
+			}
+		}
+		ckpt.MarkDone(seq)
+		summary.Scanned++
+		summary.Statuses[result.Status]++
+
+		if s.onResult != nil {
+			s.onResult(result)
+		}
+		return nil
+	}
+
+	// sorted results wait for the ones before them, an address is not done
+	// before all the ones before it are written
+	var reorder *reorderBuffer
+	if s.sortWindow > 0 {
+		reorder = newReorderBuffer(s.sortWindow, os.TempDir(), resumed.IsDone)
+		defer func() {
+			if err := reorder.Close(); err != nil {
+				s.logger.Printf("Warning: failed to remove the sort buffer: %v", err)
+			}
+		}()
+	}
+
+	// Wait for results of every job sent
+	remaining := summary.Total - summary.Resumed
+	var received uint64
+	for done := false; !done; {
+		select {
+		case r, ok := <-results:
+			if !ok {
+				done = true
+				break
+			}
+			// jobs taken once ctx was done were not looked up
+			if errors.Is(r.Err, queue.ErrStopped) {
+				continue
+			}
+			received++
+
+			result := resultOf(r)
+			var panicked *queue.PanicError
+			if errors.As(r.Err, &panicked) {
+				summary.Panics++
+				s.logger.Printf("Recovered from a panic looking up %v: %v\n%s", r.In.IP, panicked.Value, panicked.Stack)
+			}
+
+			var err error
+			if reorder != nil {
+				err = reorder.Add(r.In.Seq, result, emit)
+			} else {
+				err = emit(r.In.Seq, result)
+			}
+			if err != nil {
+				// stop the producer and the workers before giving up on the results
+				cancel()
+				//nolint:errcheck
+				dispatch.Stop(context.Background())
+				closeSink(s.sink)
+				closeFile(file)
+				summary.Duration = time.Since(started)
+				return summary, fmt.Errorf("write result: %w", err)
+			}
+
+			if s.onProgress != nil {
+				s.onProgress(received, remaining)
+			}
+
+		case <-tick:
+			if err := s.syncCheckpoint(ckpt, file); err != nil {
+				s.logger.Printf("Warning: failed to save checkpoint: %v", err)
+			}
+		}
 	}
 
-	writer := csv.NewWriter(file)
+	if reorder != nil && reorder.Len() > 0 {
+		s.logger.Printf("Dropped %v results waiting for the ones before them, they will be scanned again on resume", reorder.Len())
+	}
 
-	uiprogress.Start()
-	bar := uiprogress.AddBar(len(hosts))
-	bar.AppendCompleted()
-	bar.PrependElapsed()
+	var errs []error
+	if !summary.Complete() {
+		if err := s.syncCheckpoint(ckpt, file); err != nil {
+			errs = append(errs, fmt.Errorf("save checkpoint: %w", err))
+		}
+	}
+	if s.sink != nil {
+		if err := s.sink.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("close output: %w", err))
+		}
+	}
+	if file != nil {
+		if err := file.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("close output: %w", err))
+		}
+	}
 
-	dispatch := queue.NewDispatcher(c.WORKERS, results)
-	dispatch.Run()
+	if summary.Complete() && s.checkpoint != "" {
+		if err := os.Remove(s.checkpoint); err != nil && !os.IsNotExist(err) {
+			s.logger.Printf("Warning: failed to remove checkpoint: %v", err)
+		}
+	}
 
-	// Send Jobs to Dispatch
-	for _, ip := range hosts {
-		work := queue.Job{IP: ip}
-		dispatch.JobQueue <- work
+	// an interrupted scan reports why it stopped unless something else failed
+	if !summary.Complete() && len(errs) == 0 {
+		errs = append(errs, ctx.Err())
 	}
 
-	// Wait for results
-	for r := 0; r < len(hosts); r++ {
-		job := <-results
-		if err := writer.Write(append([]string{job.IP}, job.Names...)); err != nil {
-			writer.Flush()
-			if closeErr := file.Close(); closeErr != nil {
-				log.Printf("Warning: failed to close file: %v", closeErr)
+	summary.Duration = time.Since(started)
+	return summary, errors.Join(errs...)
+}
+
+// scanID identifies the addresses, the order and the output of a scan, a
+// checkpoint only resumes the same scan. New checks that the hosts have an ID
+// when the scan is checkpointed.
+func (s *Scanner) scanID() string {
+	hosts, _ := utils.IDOf(s.hosts)
+	desc := fmt.Appendf(nil, "%T %s", s.sink, hosts)
+	if s.sortWindow > 0 {
+		// a sorted output cannot be resumed unsorted and the other way around
+		desc = append(desc, " sorted"...)
+	}
+
+	sum := sha256.Sum256(desc)
+	return hex.EncodeToString(sum[:16])
+}
+
+// openOutput creates the output file, if any, and the checkpoint. When
+// resuming it loads the checkpoint and drops the rows written after it,
+// their addresses are scanned again so no row is duplicated.
+func (s *Scanner) openOutput(total uint64) (*os.File, *checkpoint.Checkpoint, error) {
+	// only a checkpointed scan needs an ID
+	var id string
+	if s.checkpoint != "" {
+		id = s.scanID()
+	}
+
+	if !s.resume {
+		ckpt := checkpoint.New(id, total)
+
+		var file *os.File
+		if s.output != "" {
+			var err error
+			if file, err = os.Create(s.output); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		// replace any previous checkpoint right away, it belongs to the old output
+		if s.checkpoint != "" {
+			if err := ckpt.Save(s.checkpoint); err != nil {
+				closeFile(file)
+				return nil, nil, err
 			}
-			uiprogress.Stop()
-			dispatch.Stop()
-			log.Fatalf("Failed to write result: %v", err)
 		}
-		writer.Flush()
-		bar.Incr()
+		return file, ckpt, nil
+	}
+
+	ckpt, err := checkpoint.Load(s.checkpoint)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	writer.Flush()
-	if err := file.Close(); err != nil {
-		log.Printf("Warning: failed to close file: %v", err)
+	if ckpt.Scan != id || ckpt.Total != total {
+		return nil, nil, fmt.Errorf("checkpoint %q belongs to a different scan", s.checkpoint)
 	}
-	uiprogress.Stop()
-	dispatch.Stop()
+
+	if s.output == "" {
+		return nil, ckpt, nil
+	}
+
+	file, err := os.OpenFile(s.output, os.O_RDWR, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		closeFile(file)
+		return nil, nil, err
+	}
+
+	if info.Size() < ckpt.Offset {
+		closeFile(file)
+		return nil, nil, fmt.Errorf("output %q is shorter than its checkpoint", s.output)
+	}
+
+	if err := file.Truncate(ckpt.Offset); err != nil {
+		closeFile(file)
+		return nil, nil, err
+	}
+
+	if _, err := file.Seek(ckpt.Offset, io.SeekStart); err != nil {
+		closeFile(file)
+		return nil, nil, err
+	}
+
+	return file, ckpt, nil
+}
+
+// syncCheckpoint flushes the output to disk then saves the checkpoint with the output size
+func (s *Scanner) syncCheckpoint(ckpt *checkpoint.Checkpoint, file *os.File) error {
+	if s.checkpoint == "" {
+		return nil
+	}
+
+	if f, ok := s.sink.(Flusher); ok {
+		if err := f.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if file != nil {
+		if err := file.Sync(); err != nil {
+			return err
+		}
+
+		offset, err := file.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		ckpt.Offset = offset
+	}
+
+	return ckpt.Save(s.checkpoint)
+}
+
+// discard empties a job queue without waiting for more jobs
+func discard(jobs <-chan queue.Job) {
+	for {
+		select {
+		case <-jobs:
+		default:
+			return
+		}
+	}
+}
+
+// closeFile closes a file on an error path, file may be nil
+func closeFile(file *os.File) {
+	if file != nil {
+		//nolint:errcheck
+		file.Close()
+	}
+}
+
+// closeSink closes a sink on an error path
+func closeSink(sink Sink) {
+	//nolint:errcheck
+	sink.Close()
 }
@@ -0,0 +1,545 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"io"
+	"iter"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/amine7536/reverse-scan/pkg/queue"
+	"github.com/amine7536/reverse-scan/pkg/resolver"
+	"github.com/amine7536/reverse-scan/pkg/utils"
+)
+
+// fakeResolver names every address host-<last byte>
+type fakeResolver struct{}
+
+func (fakeResolver) LookupAddr(_ context.Context, ip string) (resolver.Answer, error) {
+	return resolver.Answer{Server: "fake", Names: []string{"host-" + ip[strings.LastIndex(ip, ".")+1:] + "."}}, nil
+}
+
+func testRange(t *testing.T, start, end string) utils.Range {
+	t.Helper()
+	r, err := utils.NewRange(net.ParseIP(start), net.ParseIP(end))
+	if err != nil {
+		t.Fatalf("NewRange() unexpected error = %v", err)
+	}
+	return r
+}
+
+func TestNew(t *testing.T) {
+	hosts := testRange(t, "192.0.2.1", "192.0.2.10")
+
+	tests := []struct {
+		name    string
+		opts    []Option
+		wantErr bool
+	}{
+		{name: "hosts only", opts: []Option{WithHosts(hosts)}},
+		{name: "no hosts", opts: []Option{WithWorkers(4)}, wantErr: true},
+		{name: "zero workers", opts: []Option{WithHosts(hosts), WithWorkers(0)}, wantErr: true},
+		{name: "adaptive workers", opts: []Option{WithHosts(hosts), WithAdaptiveWorkers(1, 16)}},
+		{name: "adaptive workers decreasing", opts: []Option{WithHosts(hosts), WithAdaptiveWorkers(16, 1)}, wantErr: true},
+		{name: "resume without checkpoint", opts: []Option{WithHosts(hosts), WithResume()}, wantErr: true},
+		{name: "zero checkpoint interval", opts: []Option{WithHosts(hosts), WithCheckpoint("scan.checkpoint", 0)}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.opts...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRunStreamsResults(t *testing.T) {
+	var got []string
+	var progress uint64
+	s, err := New(
+		WithHosts(testRange(t, "192.0.2.1", "192.0.2.10")),
+		WithWorkers(3),
+		WithResolver(fakeResolver{}),
+		WithResults(func(r Result) { got = append(got, r.IP+" "+r.Names[0]) }),
+		WithProgress(func(done, total uint64) {
+			if total != 10 {
+				t.Errorf("progress total = %v, want 10", total)
+			}
+			progress = done
+		}),
+	)
+	if err != nil {
+		t.Fatalf("New() unexpected error = %v", err)
+	}
+
+	summary, err := s.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() unexpected error = %v", err)
+	}
+
+	if !summary.Complete() || summary.Scanned != 10 || summary.Statuses[resolver.StatusOK] != 10 {
+		t.Errorf("Run() summary = %+v, want 10 ok lookups", summary)
+	}
+	if progress != 10 {
+		t.Errorf("progress done = %v, want 10", progress)
+	}
+
+	slices.Sort(got)
+	if len(got) != 10 || got[0] != "192.0.2.1 host-1." || got[9] != "192.0.2.9 host-9." {
+		t.Errorf("Run() streamed %v", got)
+	}
+}
+
+func TestRunAdaptiveWorkers(t *testing.T) {
+	s, err := New(
+		WithHosts(testRange(t, "192.0.2.0", "192.0.3.255")),
+		WithAdaptiveWorkers(2, 64),
+		WithResolver(fakeResolver{}),
+	)
+	if err != nil {
+		t.Fatalf("New() unexpected error = %v", err)
+	}
+
+	summary, err := s.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() unexpected error = %v", err)
+	}
+	if !summary.Complete() || summary.Scanned != 512 {
+		t.Errorf("Run() summary = %+v, want 512 lookups", summary)
+	}
+}
+
+// interruptingResolver times out and calls interrupt on its first lookup,
+// like a Ctrl-C while the first query waits for its answer
+type interruptingResolver struct {
+	calls     *atomic.Int32
+	interrupt func()
+}
+
+func (r interruptingResolver) LookupAddr(_ context.Context, _ string) (resolver.Answer, error) {
+	if r.calls.Add(1) == 1 {
+		r.interrupt()
+	}
+	return resolver.Answer{Server: "interrupting"}, context.DeadlineExceeded
+}
+
+func TestRunInterruptedStopsRetries(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	calls := &atomic.Int32{}
+	var results []Result
+	s, err := New(
+		WithHosts(testRange(t, "192.0.2.1", "192.0.2.1")),
+		WithResolver(interruptingResolver{calls: calls, interrupt: cancel}),
+		WithRetry(resolver.RetryPolicy{MaxAttempts: 4, BaseDelay: time.Millisecond, RetryOn: []resolver.Status{resolver.StatusTimeout}}),
+		WithResults(func(r Result) { results = append(results, r) }),
+	)
+	if err != nil {
+		t.Fatalf("New() unexpected error = %v", err)
+	}
+
+	if _, err := s.Run(ctx); err != nil {
+		t.Fatalf("Run() unexpected error = %v", err)
+	}
+	if calls.Load() != 1 || len(results) != 1 || results[0].Attempts != 1 || results[0].Status != resolver.StatusTimeout {
+		t.Errorf("Run() made %d queries with results %+v, want the timeout of a single attempt", calls.Load(), results)
+	}
+}
+
+// gatedResolver holds every lookup until released, counting the lookups
+// started once canceled is set
+type gatedResolver struct {
+	started  *atomic.Int32
+	late     *atomic.Int32
+	canceled *atomic.Bool
+	release  <-chan struct{}
+}
+
+func (r gatedResolver) LookupAddr(ctx context.Context, ip string) (resolver.Answer, error) {
+	if r.canceled.Load() {
+		r.late.Add(1)
+	}
+	r.started.Add(1)
+	<-r.release
+	return fakeResolver{}.LookupAddr(ctx, ip)
+}
+
+func TestRunInterruptedStartsNoJob(t *testing.T) {
+	const workers = 8
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	release := make(chan struct{})
+	res := gatedResolver{started: &atomic.Int32{}, late: &atomic.Int32{}, canceled: &atomic.Bool{}, release: release}
+	s, err := New(
+		WithHosts(testRange(t, "192.0.2.0", "192.0.2.255")),
+		WithWorkers(workers),
+		WithResolver(res),
+	)
+	if err != nil {
+		t.Fatalf("New() unexpected error = %v", err)
+	}
+
+	// interrupt once every worker is busy and the job queue had time to fill up
+	go func() {
+		for res.started.Load() < workers {
+			time.Sleep(time.Millisecond)
+		}
+		time.Sleep(20 * time.Millisecond)
+		res.canceled.Store(true)
+		cancel()
+		close(release)
+	}()
+
+	summary, err := s.Run(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run() error = %v, want %v", err, context.Canceled)
+	}
+	if n := res.late.Load(); n != 0 {
+		t.Errorf("Run() started %d lookups after it was interrupted, want 0", n)
+	}
+	if summary.Scanned != workers {
+		t.Errorf("Run() scanned %d IPs, want the %d in flight", summary.Scanned, workers)
+	}
+}
+
+// panickingResolver panics looking up ip and answers like fakeResolver otherwise
+type panickingResolver struct {
+	ip string
+}
+
+func (r panickingResolver) LookupAddr(ctx context.Context, ip string) (resolver.Answer, error) {
+	if ip == r.ip {
+		panic("resolver bug")
+	}
+	return fakeResolver{}.LookupAddr(ctx, ip)
+}
+
+func TestRunRecoversPanic(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "out.jsonl")
+	sink, err := NewSink(FormatJSONL)
+	if err != nil {
+		t.Fatalf("NewSink() unexpected error = %v", err)
+	}
+
+	var panicked []Result
+	s, err := New(
+		WithHosts(testRange(t, "192.0.2.1", "192.0.2.10")),
+		WithWorkers(3),
+		WithResolver(panickingResolver{ip: "192.0.2.5"}),
+		WithOutput(output),
+		WithSink(sink),
+		WithResults(func(r Result) {
+			if r.Err != nil {
+				panicked = append(panicked, r)
+			}
+		}),
+	)
+	if err != nil {
+		t.Fatalf("New() unexpected error = %v", err)
+	}
+
+	// the scan goes on past the panic
+	summary, err := s.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() unexpected error = %v", err)
+	}
+	if !summary.Complete() || summary.Panics != 1 || summary.Statuses[resolver.StatusPanic] != 1 || summary.Statuses[resolver.StatusOK] != 9 {
+		t.Errorf("Run() summary = %+v, want 9 ok lookups and 1 panic", summary)
+	}
+
+	var perr *queue.PanicError
+	if len(panicked) != 1 || panicked[0].IP != "192.0.2.5" || !errors.As(panicked[0].Err, &perr) {
+		t.Fatalf("Run() error results = %+v, want the panic of 192.0.2.5", panicked)
+	}
+	if !strings.Contains(string(perr.Stack), "panickingResolver") {
+		t.Errorf("PanicError.Stack = %s, want the stack of the resolver", perr.Stack)
+	}
+
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"ip":"192.0.2.5","status":"panic","resolver":"","names":[],"rtt":0,"attempt":0,"error":"panic: resolver bug"`) {
+		t.Errorf("output %s should have the panic of 192.0.2.5", data)
+	}
+}
+
+func TestRunResume(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "out.csv")
+	ckpt := filepath.Join(dir, "out.csv.checkpoint")
+	hosts := testRange(t, "192.0.2.1", "192.0.2.100")
+
+	// interrupt the first run after a few results
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var seen int
+	first, err := New(
+		WithHosts(hosts),
+		WithWorkers(4),
+		WithResolver(fakeResolver{}),
+		WithOutput(output),
+		WithCheckpoint(ckpt, time.Hour),
+		WithResults(func(Result) {
+			if seen++; seen == 10 {
+				cancel()
+			}
+		}),
+	)
+	if err != nil {
+		t.Fatalf("New() unexpected error = %v", err)
+	}
+
+	summary, err := first.Run(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run() error = %v, want %v", err, context.Canceled)
+	}
+	if summary.Complete() || summary.Scanned < 10 {
+		t.Fatalf("Run() summary = %+v, want an interrupted scan", summary)
+	}
+
+	second, err := New(
+		WithHosts(hosts),
+		WithWorkers(4),
+		WithResolver(fakeResolver{}),
+		WithOutput(output),
+		WithCheckpoint(ckpt, time.Hour),
+		WithResume(),
+	)
+	if err != nil {
+		t.Fatalf("New() unexpected error = %v", err)
+	}
+
+	resumed, err := second.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() unexpected error = %v", err)
+	}
+	if resumed.Resumed != summary.Scanned || !resumed.Complete() {
+		t.Errorf("Run() resumed summary = %+v, want %v resumed and complete", resumed, summary.Scanned)
+	}
+
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("ReadFile() unexpected error = %v", err)
+	}
+	rows := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	slices.Sort(rows)
+	if len(rows) != 100 || len(slices.Compact(rows)) != 100 {
+		t.Errorf("output has %d rows, want 100 unique rows", len(rows))
+	}
+
+	if _, err := os.Stat(ckpt); !os.IsNotExist(err) {
+		t.Errorf("checkpoint of a complete scan should be removed, Stat() error = %v", err)
+	}
+}
+
+// failingSink fails to write any result
+type failingSink struct {
+	closed bool
+}
+
+func (s *failingSink) Open(io.Writer) error { return nil }
+
+func (s *failingSink) Write(Result) error { return errors.New("disk full") }
+
+func (s *failingSink) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestRunSinkError(t *testing.T) {
+	sink := &failingSink{}
+	s, err := New(
+		WithHosts(testRange(t, "192.0.2.1", "192.0.2.100")),
+		WithWorkers(4),
+		WithResolver(fakeResolver{}),
+		WithSink(sink),
+	)
+	if err != nil {
+		t.Fatalf("New() unexpected error = %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := s.Run(context.Background()); err == nil || !strings.Contains(err.Error(), "disk full") {
+			t.Errorf("Run() error = %v, want the sink error", err)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not return after a sink error")
+	}
+	if !sink.closed {
+		t.Error("Run() should close the sink after a write error")
+	}
+}
+
+func TestScanID(t *testing.T) {
+	r := testRange(t, "2001:db8::", "2001:db8::ffff")
+
+	shuffle := func(seed uint64) utils.Generator {
+		p, err := utils.NewPermutation(r, seed)
+		if err != nil {
+			t.Fatalf("NewPermutation() unexpected error = %v", err)
+		}
+		return p
+	}
+
+	ids := make(map[string]string)
+	for name, hosts := range map[string]utils.Generator{
+		"range":    r,
+		"lowbyte":  utils.NewSparse(r, utils.LowByteIIDs(2)),
+		"eui64":    utils.NewSparse(r, []uint64{0x021a2bfffe3c4d5e, 0x021a2bfffe3c4d5f}),
+		"targets":  utils.MergeRanges([]utils.Range{r}),
+		"other v4": testRange(t, "192.0.2.1", "192.0.2.2"),
+		"seed 1":   shuffle(1),
+		"seed 2":   shuffle(2),
+	} {
+		s, err := New(WithHosts(hosts))
+		if err != nil {
+			t.Fatalf("New() unexpected error = %v", err)
+		}
+		id := s.scanID()
+		if other, dup := ids[id]; dup {
+			t.Errorf("scans of %s and %s have the same ID", name, other)
+		}
+		ids[id] = name
+	}
+}
+
+// seqGen is a generator of a library caller, without an ID
+type seqGen iter.Seq[netip.Addr]
+
+func (g seqGen) All() iter.Seq[netip.Addr] { return iter.Seq[netip.Addr](g) }
+
+func (g seqGen) Size() uint64 {
+	var n uint64
+	for range g.All() {
+		n++
+	}
+	return n
+}
+
+func TestRunHostsWithoutID(t *testing.T) {
+	hosts := seqGen(testRange(t, "192.0.2.0", "192.0.2.9").All())
+
+	s, err := New(WithHosts(hosts), WithResolver(fakeResolver{}), WithOutput(filepath.Join(t.TempDir(), "out.csv")))
+	if err != nil {
+		t.Fatalf("New() unexpected error = %v", err)
+	}
+	summary, err := s.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() unexpected error = %v", err)
+	}
+	if !summary.Complete() || summary.Scanned != 10 {
+		t.Errorf("Run() summary = %+v, want 10 scanned", summary)
+	}
+
+	// a checkpoint could not tell the scan from another one
+	if _, err := New(WithHosts(hosts), WithCheckpoint(filepath.Join(t.TempDir(), "ckpt"), time.Second)); err == nil {
+		t.Errorf("New() with a checkpoint of hosts without an ID expected error")
+	}
+}
+
+// jitterResolver answers like fakeResolver after a random delay, so lookups
+// complete out of order
+type jitterResolver struct{}
+
+func (jitterResolver) LookupAddr(ctx context.Context, ip string) (resolver.Answer, error) {
+	time.Sleep(time.Duration(rand.IntN(500)) * time.Microsecond)
+	return fakeResolver{}.LookupAddr(ctx, ip)
+}
+
+func TestRunSorted(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "out.csv")
+	ckpt := filepath.Join(dir, "out.csv.checkpoint")
+	hosts := testRange(t, "192.0.2.0", "192.0.2.255")
+
+	// interrupt the first run, then resume it, both sorted with a window small enough to spill
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var seen int
+	first, err := New(
+		WithHosts(hosts),
+		WithWorkers(16),
+		WithResolver(jitterResolver{}),
+		WithOutput(output),
+		WithCheckpoint(ckpt, time.Hour),
+		WithSorted(4),
+		WithResults(func(Result) {
+			if seen++; seen == 100 {
+				cancel()
+			}
+		}),
+	)
+	if err != nil {
+		t.Fatalf("New() unexpected error = %v", err)
+	}
+	summary, err := first.Run(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run() error = %v, want %v", err, context.Canceled)
+	}
+
+	second, err := New(
+		WithHosts(hosts),
+		WithWorkers(16),
+		WithResolver(jitterResolver{}),
+		WithOutput(output),
+		WithCheckpoint(ckpt, time.Hour),
+		WithSorted(4),
+		WithResume(),
+	)
+	if err != nil {
+		t.Fatalf("New() unexpected error = %v", err)
+	}
+	resumed, err := second.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() unexpected error = %v", err)
+	}
+	if resumed.Resumed != summary.Scanned || !resumed.Complete() {
+		t.Errorf("Run() resumed summary = %+v, want %v resumed and complete", resumed, summary.Scanned)
+	}
+
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("ReadFile() unexpected error = %v", err)
+	}
+	rows := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	var i int
+	for ip := range hosts.All() {
+		want := ip.String() + ",ok,1,host-" + strings.Split(ip.String(), ".")[3] + "."
+		if i >= len(rows) || rows[i] != want {
+			t.Fatalf("output row %d = %q, want %q", i, rows[min(i, len(rows)-1)], want)
+		}
+		i++
+	}
+	if len(rows) != 256 {
+		t.Errorf("output has %d rows, want 256", len(rows))
+	}
+
+	// a sorted scan does not resume an unsorted one
+	unsorted, err := New(WithHosts(hosts), WithOutput(output))
+	if err != nil {
+		t.Fatalf("New() unexpected error = %v", err)
+	}
+	if second.scanID() == unsorted.scanID() {
+		t.Errorf("sorted and unsorted scans have the same ID")
+	}
+}
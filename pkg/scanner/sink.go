@@ -0,0 +1,211 @@
+package scanner
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/amine7536/reverse-scan/pkg/queue"
+	"github.com/amine7536/reverse-scan/pkg/resolver"
+)
+
+// Built-in output formats
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// Result is the outcome of the lookup of one address
+type Result struct {
+	// Time is when the last attempt completed
+	Time   time.Time
+	IP     string
+	Status resolver.Status
+	// Resolver is the server that answered the last attempt
+	Resolver string
+	Names    []string
+	// RTT is the duration of the last attempt
+	RTT      time.Duration
+	Attempts int
+	// Err is why the lookup could not complete, a *queue.PanicError with the
+	// stack trace when it panicked
+	Err error
+}
+
+// resultOf returns the result of a job, a job that failed to complete has
+// the panic status when it panicked and the other status otherwise
+func resultOf(r queue.Result[queue.Job, queue.Job]) Result {
+	if r.Err != nil {
+		status := resolver.StatusOther
+		var panicked *queue.PanicError
+		if errors.As(r.Err, &panicked) {
+			status = resolver.StatusPanic
+		}
+		return Result{Time: time.Now(), IP: r.In.IP, Status: status, Err: r.Err}
+	}
+
+	job := r.Out
+	return Result{
+		Time:     job.Time,
+		IP:       job.IP,
+		Status:   job.Status,
+		Resolver: job.Resolver,
+		Names:    job.Names,
+		RTT:      job.RTT,
+		Attempts: job.Attempts,
+	}
+}
+
+// Sink receives the results of a scan. Open is called once with the output
+// file before the first Write and Close once after the last one, the scanner
+// closes the output file itself.
+type Sink interface {
+	Open(w io.Writer) error
+	Write(result Result) error
+	Close() error
+}
+
+// Flusher is implemented by sinks buffering results. The scanner flushes
+// them before every checkpoint, a sink buffering results without it could
+// lose some of them when an interrupted scan is resumed.
+type Flusher interface {
+	Flush() error
+}
+
+var (
+	sinksMu sync.RWMutex
+	sinks   = make(map[string]func() Sink)
+)
+
+func init() {
+	RegisterSink(FormatCSV, func() Sink { return &csvSink{} })
+	RegisterSink(FormatJSONL, func() Sink { return &jsonlSink{} })
+}
+
+// RegisterSink makes a sink available as an output format, newSink is called
+// once per scan. It panics if the format is already registered.
+func RegisterSink(format string, newSink func() Sink) {
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+
+	if newSink == nil {
+		panic("scanner: RegisterSink sink is nil")
+	}
+	if _, dup := sinks[format]; dup {
+		panic("scanner: RegisterSink called twice for format " + format)
+	}
+	sinks[format] = newSink
+}
+
+// NewSink returns a new sink of the given output format
+func NewSink(format string) (Sink, error) {
+	sinksMu.RLock()
+	newSink, ok := sinks[format]
+	sinksMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown output format %q, must be one of %v", format, Formats())
+	}
+	return newSink(), nil
+}
+
+// Formats returns the sorted names of the registered output formats
+func Formats() []string {
+	sinksMu.RLock()
+	defer sinksMu.RUnlock()
+
+	formats := make([]string, 0, len(sinks))
+	for format := range sinks {
+		formats = append(formats, format)
+	}
+	slices.Sort(formats)
+	return formats
+}
+
+// csvSink writes one row per result: the IP, the status, the number of
+// attempts then the names found
+type csvSink struct {
+	w *csv.Writer
+}
+
+func (c *csvSink) Open(w io.Writer) error {
+	c.w = csv.NewWriter(w)
+	return nil
+}
+
+func (c *csvSink) Write(result Result) error {
+	return c.w.Write(append([]string{result.IP, string(result.Status), strconv.Itoa(result.Attempts)}, result.Names...))
+}
+
+func (c *csvSink) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvSink) Close() error {
+	return c.Flush()
+}
+
+// jsonResult is the JSON Lines encoding of a result
+type jsonResult struct {
+	Timestamp time.Time       `json:"timestamp"`
+	IP        string          `json:"ip"`
+	Status    resolver.Status `json:"status"`
+	Resolver  string          `json:"resolver"`
+	Names     []string        `json:"names"`
+	// RTT is the duration of the last attempt in milliseconds
+	RTT     float64 `json:"rtt"`
+	Attempt int     `json:"attempt"`
+	// Error is why the lookup could not complete
+	Error string `json:"error,omitempty"`
+}
+
+// jsonlSink writes one JSON object per line and result
+type jsonlSink struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func (j *jsonlSink) Open(w io.Writer) error {
+	j.w = bufio.NewWriter(w)
+	j.enc = json.NewEncoder(j.w)
+	return nil
+}
+
+func (j *jsonlSink) Write(result Result) error {
+	names := result.Names
+	if names == nil {
+		names = []string{}
+	}
+
+	var message string
+	if result.Err != nil {
+		message = result.Err.Error()
+	}
+
+	return j.enc.Encode(jsonResult{
+		Error:     message,
+		IP:        result.IP,
+		Names:     names,
+		Status:    result.Status,
+		RTT:       float64(result.RTT.Microseconds()) / 1000,
+		Resolver:  result.Resolver,
+		Attempt:   result.Attempts,
+		Timestamp: result.Time.UTC(),
+	})
+}
+
+func (j *jsonlSink) Flush() error {
+	return j.w.Flush()
+}
+
+func (j *jsonlSink) Close() error {
+	return j.Flush()
+}
@@ -0,0 +1,164 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/amine7536/reverse-scan/pkg/resolver"
+)
+
+var testResults = []Result{
+	{
+		IP:       "192.0.2.1",
+		Status:   resolver.StatusOK,
+		Names:    []string{"a.example.com.", "b.example.com."},
+		Attempts: 1,
+		Resolver: "127.0.0.1:53",
+		RTT:      1500 * time.Microsecond,
+		Time:     time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	},
+	{
+		IP:       "192.0.2.2",
+		Status:   resolver.StatusTimeout,
+		Attempts: 3,
+		Resolver: "127.0.0.1:53",
+		RTT:      2 * time.Second,
+		Time:     time.Date(2024, 1, 2, 3, 4, 6, 0, time.UTC),
+	},
+}
+
+// writeAll writes the results through a new sink of format and returns the output
+func writeAll(t *testing.T, format string, results []Result) string {
+	t.Helper()
+
+	sink, err := NewSink(format)
+	if err != nil {
+		t.Fatalf("NewSink() unexpected error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := sink.Open(&buf); err != nil {
+		t.Fatalf("Open() unexpected error = %v", err)
+	}
+	for _, result := range results {
+		if err := sink.Write(result); err != nil {
+			t.Fatalf("Write() unexpected error = %v", err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close() unexpected error = %v", err)
+	}
+	return buf.String()
+}
+
+func TestCSVSink(t *testing.T) {
+	got := writeAll(t, FormatCSV, testResults)
+	want := "192.0.2.1,ok,1,a.example.com.,b.example.com.\n192.0.2.2,timeout,3\n"
+	if got != want {
+		t.Errorf("CSV output = %q, want %q", got, want)
+	}
+}
+
+func TestJSONLSink(t *testing.T) {
+	lines := strings.Split(strings.TrimSuffix(writeAll(t, FormatJSONL, testResults), "\n"), "\n")
+	if len(lines) != len(testResults) {
+		t.Fatalf("JSONL output has %d lines, want %d", len(lines), len(testResults))
+	}
+
+	var first map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatalf("invalid JSON line %q: %v", lines[0], err)
+	}
+	for key, want := range map[string]any{
+		"ip":        "192.0.2.1",
+		"status":    "ok",
+		"rtt":       1.5,
+		"resolver":  "127.0.0.1:53",
+		"attempt":   float64(1),
+		"timestamp": "2024-01-02T03:04:05Z",
+	} {
+		if first[key] != want {
+			t.Errorf("JSON %q = %v, want %v", key, first[key], want)
+		}
+	}
+
+	// an address without names gets an empty list, not null
+	if !strings.Contains(lines[1], `"names":[]`) {
+		t.Errorf("JSON line %q should have an empty names list", lines[1])
+	}
+	// only the lookups that failed to complete have an error
+	if _, ok := first["error"]; ok {
+		t.Errorf("JSON line %q should have no error", lines[0])
+	}
+}
+
+func TestBuiltinSinksFlush(t *testing.T) {
+	for _, format := range []string{FormatCSV, FormatJSONL} {
+		sink, err := NewSink(format)
+		if err != nil {
+			t.Fatalf("NewSink(%q) unexpected error = %v", format, err)
+		}
+		if _, ok := sink.(Flusher); !ok {
+			t.Errorf("sink %q buffers results and should implement Flusher", format)
+		}
+	}
+}
+
+func TestNewSinkUnknownFormat(t *testing.T) {
+	if _, err := NewSink("xml"); err == nil {
+		t.Error("NewSink() should error on unknown format")
+	}
+}
+
+// ipSink writes the IP of every result, one per line
+type ipSink struct {
+	w io.Writer
+}
+
+func (s *ipSink) Open(w io.Writer) error {
+	s.w = w
+	return nil
+}
+
+func (s *ipSink) Write(result Result) error {
+	_, err := io.WriteString(s.w, result.IP+"\n")
+	return err
+}
+
+func (s *ipSink) Close() error {
+	return nil
+}
+
+// registerIPSink registers ipSink once however many times the tests run
+var registerIPSink sync.Once
+
+func TestRegisterSink(t *testing.T) {
+	registerIPSink.Do(func() {
+		RegisterSink("test-ips", func() Sink { return &ipSink{} })
+	})
+
+	if !slices.Contains(Formats(), "test-ips") {
+		t.Errorf("Formats() = %v, should contain test-ips", Formats())
+	}
+	if !slices.IsSorted(Formats()) {
+		t.Errorf("Formats() = %v, want sorted", Formats())
+	}
+
+	got := writeAll(t, "test-ips", testResults)
+	if want := "192.0.2.1\n192.0.2.2\n"; got != want {
+		t.Errorf("custom sink output = %q, want %q", got, want)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("RegisterSink() should panic when the format is already registered")
+		}
+	}()
+	RegisterSink(FormatCSV, func() Sink { return &ipSink{} })
+}
@@ -0,0 +1,141 @@
+package scanner
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/json"
+	"errors"
+	"io"
+	"iter"
+	"os"
+)
+
+// sortedRuns keeps sorted runs of values in a temporary file and reads them
+// back in order, a heap holding the next value of every run. The values are
+// JSON encoded, the runs are appended to the file and read at their offsets.
+type sortedRuns[T any] struct {
+	heap runHeap[T]
+	file *os.File
+	// dir and pattern name the file, created by the first spill
+	dir     string
+	pattern string
+	// size is the number of bytes written to file
+	size int64
+	// count is the number of values waiting in the runs
+	count int
+}
+
+// run is a sorted sequence of spilled values, head is the next one
+type run[T any] struct {
+	dec  *json.Decoder
+	head T
+}
+
+// runHeap orders the runs by their head
+type runHeap[T any] struct {
+	runs []*run[T]
+	less func(a, b T) bool
+}
+
+func (h *runHeap[T]) Len() int           { return len(h.runs) }
+func (h *runHeap[T]) Less(i, j int) bool { return h.less(h.runs[i].head, h.runs[j].head) }
+func (h *runHeap[T]) Swap(i, j int)      { h.runs[i], h.runs[j] = h.runs[j], h.runs[i] }
+func (h *runHeap[T]) Push(x any)         { h.runs = append(h.runs, x.(*run[T])) }
+func (h *runHeap[T]) Pop() any {
+	r := h.runs[len(h.runs)-1]
+	h.runs = h.runs[:len(h.runs)-1]
+	return r
+}
+
+// newSortedRuns returns runs read back in the order of less, spilled to a
+// file of dir named after pattern as os.CreateTemp does
+func newSortedRuns[T any](dir, pattern string, less func(a, b T) bool) *sortedRuns[T] {
+	return &sortedRuns[T]{heap: runHeap[T]{less: less}, dir: dir, pattern: pattern}
+}
+
+// Spill writes values, sorted by less, to a new run
+func (s *sortedRuns[T]) Spill(values iter.Seq[T]) error {
+	if s.file == nil {
+		f, err := os.CreateTemp(s.dir, s.pattern)
+		if err != nil {
+			return err
+		}
+		s.file = f
+	}
+
+	start := s.size
+	w := bufio.NewWriter(s.file)
+	enc := json.NewEncoder(w)
+	n := 0
+	for v := range values {
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		n++
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	end, err := s.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	s.size = end
+
+	if n == 0 {
+		return nil
+	}
+	r := &run[T]{dec: json.NewDecoder(io.NewSectionReader(s.file, start, end-start))}
+	if err := r.dec.Decode(&r.head); err != nil {
+		return err
+	}
+	heap.Push(&s.heap, r)
+	s.count += n
+	return nil
+}
+
+// Len returns the number of values waiting in the runs
+func (s *sortedRuns[T]) Len() int {
+	return s.count
+}
+
+// Runs returns the number of runs holding values, one value of each is in memory
+func (s *sortedRuns[T]) Runs() int {
+	return s.heap.Len()
+}
+
+// Peek returns the next value in order, false when every value was read
+func (s *sortedRuns[T]) Peek() (T, bool) {
+	if s.heap.Len() == 0 {
+		var zero T
+		return zero, false
+	}
+	return s.heap.runs[0].head, true
+}
+
+// Next drops the value returned by Peek, moving its run to its next value
+func (s *sortedRuns[T]) Next() error {
+	s.count--
+	r := s.heap.runs[0]
+	var head T
+	err := r.dec.Decode(&head)
+	if errors.Is(err, io.EOF) {
+		heap.Pop(&s.heap)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	r.head = head
+	heap.Fix(&s.heap, 0)
+	return nil
+}
+
+// Close removes the file, the values still waiting are dropped
+func (s *sortedRuns[T]) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	return errors.Join(err, os.Remove(s.file.Name()))
+}
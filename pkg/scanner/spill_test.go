@@ -0,0 +1,42 @@
+package scanner
+
+import (
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestSortedRuns(t *testing.T) {
+	dir := t.TempDir()
+	runs := newSortedRuns(dir, "runs-*", func(a, b int) bool { return a < b })
+
+	for _, run := range [][]int{{1, 4, 7}, {}, {2, 3, 9}, {0, 5, 6, 8}} {
+		if err := runs.Spill(slices.Values(run)); err != nil {
+			t.Fatalf("Spill() unexpected error = %v", err)
+		}
+	}
+	if runs.Len() != 10 || runs.Runs() != 3 {
+		t.Errorf("Len() = %v and Runs() = %v, want 10 and 3", runs.Len(), runs.Runs())
+	}
+
+	var got []int
+	for v, ok := runs.Peek(); ok; v, ok = runs.Peek() {
+		got = append(got, v)
+		if err := runs.Next(); err != nil {
+			t.Fatalf("Next() unexpected error = %v", err)
+		}
+	}
+	if want := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}; !slices.Equal(got, want) {
+		t.Errorf("read back %v, want %v", got, want)
+	}
+	if runs.Len() != 0 {
+		t.Errorf("Len() = %v after the last value, want 0", runs.Len())
+	}
+
+	if err := runs.Close(); err != nil {
+		t.Errorf("Close() unexpected error = %v", err)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Errorf("Close() left %v in the spill directory", files)
+	}
+}
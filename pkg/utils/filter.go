@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"fmt"
+	"iter"
+	"net/netip"
+	"slices"
+	"sort"
+)
+
+// LastByteFilter yields the addresses of Ranges except the IPv4 ones whose
+// last byte is in Skip, like the .0 and .255 of every /24 of a classful block
+type LastByteFilter struct {
+	Ranges Ranges
+	Skip   []byte
+}
+
+// NewLastByteFilter returns the addresses of rs without the IPv4 ones ending in skip
+func NewLastByteFilter(rs Ranges, skip []byte) LastByteFilter {
+	skip = slices.Clone(skip)
+	slices.Sort(skip)
+	return LastByteFilter{Ranges: rs, Skip: slices.Compact(skip)}
+}
+
+// ID describes the ranges and the skipped last bytes
+func (f LastByteFilter) ID() string {
+	return fmt.Sprintf("lastbyte(%v, %v)", f.Ranges, f.Skip)
+}
+
+// All returns an iterator over the addresses that are not skipped, in ascending order
+func (f LastByteFilter) All() iter.Seq[netip.Addr] {
+	var skip [256]bool
+	for _, b := range f.Skip {
+		skip[b] = true
+	}
+
+	return func(yield func(netip.Addr) bool) {
+		for ip := range f.Ranges.All() {
+			if ip.Is4() && skip[ip.As4()[3]] {
+				continue
+			}
+			if !yield(ip) {
+				return
+			}
+		}
+	}
+}
+
+// Size returns the number of addresses that are not skipped, saturating at math.MaxUint64
+func (f LastByteFilter) Size() uint64 {
+	total := f.Ranges.Size()
+	for _, r := range f.Ranges {
+		if r.Start.Is4() {
+			start, end := addrToUint32(r.Start), addrToUint32(r.End)
+			total -= uint64(end-start) + 1 - f.keptIn(start, end)
+		}
+	}
+	return total
+}
+
+// Index returns a function mapping a position below Size to its address
+func (f LastByteFilter) Index() func(i uint64) netip.Addr {
+	sizes := make([]uint64, len(f.Ranges))
+	index := make([]func(uint64) netip.Addr, len(f.Ranges))
+	for k, r := range f.Ranges {
+		sizes[k], index[k] = r.Size(), r.Index()
+		if r.Start.Is4() && len(f.Skip) > 0 {
+			start, end := addrToUint32(r.Start), addrToUint32(r.End)
+			sizes[k], index[k] = f.keptIn(start, end), f.indexIn(start, end)
+		}
+	}
+	return indexParts(sizes, index)
+}
+
+// keptIn returns the number of addresses in [start, end] that are not skipped
+func (f LastByteFilter) keptIn(start, end uint32) uint64 {
+	kept := uint64(end-start) + 1
+	for _, b := range f.Skip {
+		kept -= endingIn(end, b) - endingIn(start, b)
+		if start&0xff == uint32(b) {
+			kept--
+		}
+	}
+	return kept
+}
+
+// indexIn maps a position to the address of [start, end] with a binary
+// search on the number of addresses kept from start
+func (f LastByteFilter) indexIn(start, end uint32) func(i uint64) netip.Addr {
+	return func(i uint64) netip.Addr {
+		n := sort.Search(int(end-start)+1, func(n int) bool {
+			return f.keptIn(start, start+uint32(n)) > i
+		})
+		return uint32ToAddr(start + uint32(n))
+	}
+}
+
+// endingIn returns the number of addresses in [0, n] whose last byte is b
+func endingIn(n uint32, b byte) uint64 {
+	if n < uint32(b) {
+		return 0
+	}
+	return uint64(n-uint32(b))/256 + 1
+}
+
+// addrToUint32 returns an IPv4 address as an integer
+func addrToUint32(a netip.Addr) uint32 {
+	b := a.As4()
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+}
+
+// uint32ToAddr returns the IPv4 address of an integer
+func uint32ToAddr(n uint32) netip.Addr {
+	return netip.AddrFrom4([4]byte{byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)})
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"testing"
+)
+
+func TestLastByteFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		ranges []Range
+		skip   []byte
+	}{
+		{
+			name:   "every /24 of a /16",
+			ranges: []Range{mustRange(t, "10.1.0.0", "10.1.255.255")},
+			skip:   []byte{0, 255},
+		},
+		{
+			name:   "partial blocks",
+			ranges: []Range{mustRange(t, "10.0.0.200", "10.0.3.10")},
+			skip:   []byte{255, 0, 5, 250, 0},
+		},
+		{
+			name:   "starting on a skipped byte",
+			ranges: []Range{mustRange(t, "10.0.0.255", "10.0.1.0")},
+			skip:   []byte{0, 255},
+		},
+		{
+			name:   "whole IPv4 space edges",
+			ranges: []Range{mustRange(t, "0.0.0.0", "0.0.1.255"), mustRange(t, "255.255.255.0", "255.255.255.255")},
+			skip:   []byte{0},
+		},
+		{
+			name:   "IPv6 untouched",
+			ranges: []Range{mustRange(t, "10.0.0.0", "10.0.0.255"), mustRange(t, "2001:db8::", "2001:db8::1ff")},
+			skip:   []byte{0, 255},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewLastByteFilter(MergeRanges(tt.ranges), tt.skip)
+
+			var n uint64
+			for ip := range f.All() {
+				if ip.Is4() {
+					for _, b := range tt.skip {
+						if ip.As4()[3] == b {
+							t.Fatalf("LastByteFilter.All() yielded %v", ip)
+						}
+					}
+				}
+				n++
+			}
+			if got := f.Size(); got != n {
+				t.Errorf("LastByteFilter.Size() = %v, All() yielded %v", got, n)
+			}
+		})
+	}
+}
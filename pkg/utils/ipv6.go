@@ -0,0 +1,194 @@
+package utils
+
+import (
+	"fmt"
+	"iter"
+	"math"
+	"math/bits"
+	"net"
+	"net/netip"
+	"slices"
+)
+
+// MaxFullScan is the largest range that may be walked address by address.
+// Bigger IPv6 ranges must use a sparse strategy, a /64 walk would never finish.
+const MaxFullScan uint64 = 1 << 32
+
+// Sparse enumerates, in every /64 of an IPv6 range, a fixed set of interface
+// identifiers instead of the 2^64 possible ones
+type Sparse struct {
+	Range Range
+	IIDs  []uint64
+}
+
+// NewSparse returns a Sparse generator for the given interface identifiers
+func NewSparse(r Range, iids []uint64) Sparse {
+	iids = slices.Clone(iids)
+	slices.Sort(iids)
+	return Sparse{Range: r, IIDs: slices.Compact(iids)}
+}
+
+// LowByteIIDs returns the interface identifiers ::1 to ::n, the low-byte
+// pattern commonly used for manually numbered hosts
+func LowByteIIDs(n int) []uint64 {
+	iids := make([]uint64, 0, n)
+	for i := 1; i <= n; i++ {
+		iids = append(iids, uint64(i))
+	}
+	return iids
+}
+
+// EUI64IID returns the modified EUI-64 interface identifier SLAAC derives from a MAC address
+func EUI64IID(mac net.HardwareAddr) (uint64, error) {
+	if len(mac) != 6 {
+		return 0, fmt.Errorf("invalid MAC address for EUI-64: %v", mac)
+	}
+
+	// flip the universal/local bit and insert ff:fe in the middle
+	b := []byte{mac[0] ^ 0x02, mac[1], mac[2], 0xff, 0xfe, mac[3], mac[4], mac[5]}
+
+	var iid uint64
+	for _, v := range b {
+		iid = iid<<8 | uint64(v)
+	}
+	return iid, nil
+}
+
+// ID describes the range and the interface identifiers
+func (s Sparse) ID() string {
+	return fmt.Sprintf("sparse(%v, %v)", s.Range, s.IIDs)
+}
+
+// All returns an iterator over the candidate addresses of every /64 in the range
+func (s Sparse) All() iter.Seq[netip.Addr] {
+	return func(yield func(netip.Addr) bool) {
+		if s.Range.Size() == 0 || len(s.IIDs) == 0 {
+			return
+		}
+
+		first, _ := addrToUint128(s.Range.Start)
+		last, _ := addrToUint128(s.Range.End)
+
+		for hi := first; ; hi++ {
+			for _, iid := range s.IIDs {
+				ip := uint128ToAddr(hi, iid)
+				if s.Range.Contains(ip) && !yield(ip) {
+					return
+				}
+			}
+			if hi == last {
+				return
+			}
+		}
+	}
+}
+
+// Size returns the number of addresses All yields, saturating at math.MaxUint64
+func (s Sparse) Size() uint64 {
+	if s.Range.Size() == 0 || len(s.IIDs) == 0 {
+		return 0
+	}
+
+	first, _ := addrToUint128(s.Range.Start)
+	last, _ := addrToUint128(s.Range.End)
+
+	if first == last {
+		return s.countIn(first)
+	}
+
+	// Only the first and last /64 may be partially covered by the range
+	total := s.countIn(first) + s.countIn(last)
+	middle := last - first - 1
+
+	hi, lo := bits.Mul64(middle, uint64(len(s.IIDs)))
+	if hi != 0 {
+		return math.MaxUint64
+	}
+	sum, carry := bits.Add64(lo, total, 0)
+	if carry != 0 {
+		return math.MaxUint64
+	}
+	return sum
+}
+
+// Index returns a function mapping a position below Size to its address
+func (s Sparse) Index() func(i uint64) netip.Addr {
+	first, _ := addrToUint128(s.Range.Start)
+	last, _ := addrToUint128(s.Range.End)
+
+	// the first and last /64 may only hold some of the identifiers
+	head, tail := s.keptIn(first), s.keptIn(last)
+	n := uint64(len(s.IIDs))
+
+	return func(i uint64) netip.Addr {
+		if i < uint64(len(head)) {
+			return uint128ToAddr(first, head[i])
+		}
+		i -= uint64(len(head))
+		if block := i / n; block < last-first-1 {
+			return uint128ToAddr(first+1+block, s.IIDs[i%n])
+		}
+		return uint128ToAddr(last, tail[i-(last-first-1)*n])
+	}
+}
+
+// keptIn returns the identifiers whose address in the /64 hi is inside the range
+func (s Sparse) keptIn(hi uint64) []uint64 {
+	var kept []uint64
+	for _, iid := range s.IIDs {
+		if s.Range.Contains(uint128ToAddr(hi, iid)) {
+			kept = append(kept, iid)
+		}
+	}
+	return kept
+}
+
+func (s Sparse) countIn(hi uint64) uint64 {
+	var n uint64
+	for _, iid := range s.IIDs {
+		if s.Range.Contains(uint128ToAddr(hi, iid)) {
+			n++
+		}
+	}
+	return n
+}
+
+// Seeds enumerates a list of known addresses, keeping those inside the range
+type Seeds struct {
+	Range Range
+	Addrs []netip.Addr
+}
+
+// NewSeeds returns a Seeds generator, addresses are sorted and deduplicated
+func NewSeeds(r Range, addrs []netip.Addr) Seeds {
+	var kept []netip.Addr
+	for _, a := range addrs {
+		if a = a.Unmap(); r.Contains(a) {
+			kept = append(kept, a)
+		}
+	}
+	slices.SortFunc(kept, netip.Addr.Compare)
+	return Seeds{Range: r, Addrs: slices.Compact(kept)}
+}
+
+// ID describes the range and the seed addresses
+func (s Seeds) ID() string {
+	return fmt.Sprintf("seeds(%v, %v)", s.Range, s.Addrs)
+}
+
+// All returns an iterator over the seed addresses
+func (s Seeds) All() iter.Seq[netip.Addr] {
+	return slices.Values(s.Addrs)
+}
+
+// Index returns a function mapping a position below Size to its address
+func (s Seeds) Index() func(i uint64) netip.Addr {
+	return func(i uint64) netip.Addr {
+		return s.Addrs[i]
+	}
+}
+
+// Size returns the number of seed addresses
+func (s Seeds) Size() uint64 {
+	return uint64(len(s.Addrs))
+}
@@ -0,0 +1,156 @@
+package utils
+
+import (
+	"math"
+	"net"
+	"net/netip"
+	"testing"
+)
+
+func mustRange(t *testing.T, start, end string) Range {
+	t.Helper()
+	r, err := NewRange(net.ParseIP(start), net.ParseIP(end))
+	if err != nil {
+		t.Fatalf("NewRange(%v, %v) unexpected error = %v", start, end, err)
+	}
+	return r
+}
+
+func TestEUI64IID(t *testing.T) {
+	tests := []struct {
+		name    string
+		mac     string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "universal MAC",
+			mac:  "00:1a:2b:3c:4d:5e",
+			want: "2001:db8::21a:2bff:fe3c:4d5e",
+		},
+		{
+			name: "local MAC",
+			mac:  "02:00:00:00:00:01",
+			want: "2001:db8::ff:fe00:1",
+		},
+		{
+			name:    "EUI-64 MAC",
+			mac:     "00:00:00:00:fe:80:00:00",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mac, err := net.ParseMAC(tt.mac)
+			if err != nil {
+				t.Fatalf("ParseMAC() unexpected error = %v", err)
+			}
+			iid, err := EUI64IID(mac)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("EUI64IID() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			prefix, _ := addrToUint128(netip.MustParseAddr("2001:db8::"))
+			if got := uint128ToAddr(prefix, iid).String(); got != tt.want {
+				t.Errorf("EUI64IID() address = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSparse(t *testing.T) {
+	tests := []struct {
+		name     string
+		start    string
+		end      string
+		iids     []uint64
+		wantSize uint64
+	}{
+		{
+			name:     "single /64",
+			start:    "2001:db8::",
+			end:      "2001:db8::ffff:ffff:ffff:ffff",
+			iids:     LowByteIIDs(16),
+			wantSize: 16,
+		},
+		{
+			name:     "/60 holds 16 subnets",
+			start:    "2001:db8::",
+			end:      "2001:db8:0:f:ffff:ffff:ffff:ffff",
+			iids:     LowByteIIDs(4),
+			wantSize: 64,
+		},
+		{
+			name:     "partial first and last /64",
+			start:    "2001:db8::3",
+			end:      "2001:db8:0:2::2",
+			iids:     LowByteIIDs(4),
+			wantSize: 2 + 4 + 2,
+		},
+		{
+			name:     "duplicated identifiers",
+			start:    "2001:db8::",
+			end:      "2001:db8::ffff:ffff:ffff:ffff",
+			iids:     []uint64{3, 1, 3, 2},
+			wantSize: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSparse(mustRange(t, tt.start, tt.end), tt.iids)
+			if got := s.Size(); got != tt.wantSize {
+				t.Errorf("Sparse.Size() = %v, want %v", got, tt.wantSize)
+			}
+
+			var count uint64
+			var prev netip.Addr
+			for ip := range s.All() {
+				if !s.Range.Contains(ip) {
+					t.Errorf("Sparse.All() yielded %v outside of %v", ip, s.Range)
+				}
+				if prev.IsValid() && !prev.Less(ip) {
+					t.Errorf("Sparse.All() yielded %v after %v", ip, prev)
+				}
+				prev = ip
+				count++
+			}
+			if count != tt.wantSize {
+				t.Errorf("Sparse.All() yielded %v addresses, want %v", count, tt.wantSize)
+			}
+		})
+	}
+}
+
+func TestSparseSizeSaturates(t *testing.T) {
+	s := NewSparse(mustRange(t, "::", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"), LowByteIIDs(256))
+	if got := s.Size(); got != math.MaxUint64 {
+		t.Errorf("Sparse.Size() = %v, want %v", got, uint64(math.MaxUint64))
+	}
+}
+
+func TestSeeds(t *testing.T) {
+	r := mustRange(t, "2001:db8::", "2001:db8::ffff")
+	s := NewSeeds(r, []netip.Addr{
+		netip.MustParseAddr("2001:db8::10"),
+		netip.MustParseAddr("2001:db8::1"),
+		netip.MustParseAddr("2001:db8::10"),
+		netip.MustParseAddr("2001:db8:1::1"),
+	})
+
+	want := []string{"2001:db8::1", "2001:db8::10"}
+	if s.Size() != uint64(len(want)) {
+		t.Fatalf("Seeds.Size() = %v, want %v", s.Size(), len(want))
+	}
+
+	i := 0
+	for ip := range s.All() {
+		if ip.String() != want[i] {
+			t.Errorf("Seeds.All()[%d] = %v, want %v", i, ip, want[i])
+		}
+		i++
+	}
+}
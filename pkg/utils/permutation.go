@@ -0,0 +1,159 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+	"math"
+	"math/bits"
+	"net/netip"
+	"sort"
+)
+
+// Indexed is a Generator whose addresses can be read by position, in the
+// order All yields them
+type Indexed interface {
+	Generator
+	// Index returns a function mapping a position below Size to its address
+	Index() func(i uint64) netip.Addr
+}
+
+// feistelRounds is the number of rounds of the permutation, enough to
+// scatter consecutive positions, it is not meant to be cryptographic
+const feistelRounds = 4
+
+// Permutation yields the addresses of Hosts in a pseudo-random order set by
+// Seed. Positions are shuffled by a Feistel network, the addresses are never
+// held in memory and a seed always gives the same order.
+type Permutation struct {
+	Hosts Indexed
+	Seed  uint64
+}
+
+// NewPermutation returns the addresses of g in the order set by seed
+func NewPermutation(g Generator, seed uint64) (Permutation, error) {
+	if !isIndexed(g) {
+		return Permutation{}, fmt.Errorf("cannot randomize the order of %T", g)
+	}
+	if g.Size() == math.MaxUint64 {
+		return Permutation{}, errors.New("too many addresses to randomize their order")
+	}
+	return Permutation{Hosts: g.(Indexed), Seed: seed}, nil
+}
+
+// ID describes the addresses and the seed, empty when Hosts has no ID
+func (p Permutation) ID() string {
+	hosts, ok := IDOf(p.Hosts)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("permutation(%s, %d)", hosts, p.Seed)
+}
+
+// All returns an iterator over every address of Hosts, each one once
+func (p Permutation) All() iter.Seq[netip.Addr] {
+	return func(yield func(netip.Addr) bool) {
+		n := p.Hosts.Size()
+		if n == 0 {
+			return
+		}
+
+		at := p.Index()
+		for i := range n {
+			if !yield(at(i)) {
+				return
+			}
+		}
+	}
+}
+
+// Size returns the number of addresses of Hosts
+func (p Permutation) Size() uint64 {
+	return p.Hosts.Size()
+}
+
+// Index returns a function mapping a position below Size to its address
+func (p Permutation) Index() func(i uint64) netip.Addr {
+	at := p.Hosts.Index()
+	f := newFeistel(p.Hosts.Size(), p.Seed)
+	return func(i uint64) netip.Addr {
+		return at(f.permute(i))
+	}
+}
+
+// feistel is a bijection of [0, n) built from a balanced Feistel network on
+// the smallest even number of bits holding n-1. Values of the network that
+// fall outside [0, n) are fed back in until they land inside, the domain is
+// less than 4n so a few rounds are enough.
+type feistel struct {
+	n    uint64
+	half uint
+	mask uint64
+	keys [feistelRounds]uint64
+}
+
+func newFeistel(n, seed uint64) *feistel {
+	half := max((uint(bits.Len64(n-1))+1)/2, 1)
+	f := &feistel{n: n, half: half, mask: 1<<half - 1}
+	for k := range f.keys {
+		seed += 0x9e3779b97f4a7c15
+		f.keys[k] = mix64(seed)
+	}
+	return f
+}
+
+// permute returns the position of the i-th address, i must be below n
+func (f *feistel) permute(i uint64) uint64 {
+	for {
+		i = f.encrypt(i)
+		if i < f.n {
+			return i
+		}
+	}
+}
+
+func (f *feistel) encrypt(x uint64) uint64 {
+	l, r := x>>f.half, x&f.mask
+	for _, key := range f.keys {
+		l, r = r, l^(mix64(r^key)&f.mask)
+	}
+	return l<<f.half | r
+}
+
+// mix64 is the splitmix64 finalizer, it spreads every input bit over the output
+func mix64(x uint64) uint64 {
+	x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x>>27) * 0x94d049bb133111eb
+	return x ^ x>>31
+}
+
+// indexParts maps a position to an address of consecutive parts given by
+// their sizes and index functions
+func indexParts(sizes []uint64, index []func(uint64) netip.Addr) func(i uint64) netip.Addr {
+	// ends[k] is the position following the last address of part k
+	ends := make([]uint64, len(sizes))
+	var total uint64
+	for k, size := range sizes {
+		total += size
+		ends[k] = total
+	}
+
+	return func(i uint64) netip.Addr {
+		k := sort.Search(len(ends), func(k int) bool { return ends[k] > i })
+		return index[k](i - (ends[k] - sizes[k]))
+	}
+}
+
+// isIndexed reports whether g and, for a Chain, each of its generators is Indexed
+func isIndexed(g Generator) bool {
+	if c, ok := g.(Chain); ok {
+		for _, part := range c {
+			if !isIndexed(part) {
+				return false
+			}
+		}
+		return true
+	}
+	_, ok := g.(Indexed)
+	return ok
+}
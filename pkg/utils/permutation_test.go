@@ -0,0 +1,158 @@
+package utils
+
+import (
+	"iter"
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+// indexedGenerators returns a generator of every Indexed type
+func indexedGenerators(t *testing.T) map[string]Indexed {
+	t.Helper()
+	v6 := mustRange(t, "2001:db8::fffe", "2001:db8:0:2::1")
+
+	return map[string]Indexed{
+		"range":  mustRange(t, "10.0.0.250", "10.0.1.5"),
+		"ranges": MergeRanges([]Range{mustRange(t, "10.0.0.0", "10.0.0.9"), mustRange(t, "10.0.2.0", "10.0.2.3"), mustRange(t, "2001:db8::", "2001:db8::5")}),
+		"last byte filter": NewLastByteFilter(
+			MergeRanges([]Range{mustRange(t, "10.0.0.254", "10.0.3.1"), mustRange(t, "2001:db8::", "2001:db8::3")}),
+			[]byte{0, 255, 1},
+		),
+		"sparse":        NewSparse(v6, []uint64{0, 1, 2, 0xffff}),
+		"sparse single": NewSparse(mustRange(t, "2001:db8::", "2001:db8::1"), []uint64{0, 1, 2}),
+		"seeds":         NewSeeds(v6, []netip.Addr{netip.MustParseAddr("2001:db8:0:1::1"), netip.MustParseAddr("2001:db8::ffff")}),
+		"chain": Chain{
+			NewLastByteFilter(Ranges{mustRange(t, "10.0.0.0", "10.0.1.255")}, []byte{0}),
+			NewSparse(v6, []uint64{1}),
+		},
+	}
+}
+
+func TestIndex(t *testing.T) {
+	for name, g := range indexedGenerators(t) {
+		t.Run(name, func(t *testing.T) {
+			at := g.Index()
+
+			var i uint64
+			for want := range g.All() {
+				if got := at(i); got != want {
+					t.Errorf("Index()(%d) = %v, want %v", i, got, want)
+				}
+				i++
+			}
+			if i != g.Size() {
+				t.Errorf("Size() = %v, All() yielded %v", g.Size(), i)
+			}
+		})
+	}
+}
+
+func TestPermutation(t *testing.T) {
+	for name, g := range indexedGenerators(t) {
+		t.Run(name, func(t *testing.T) {
+			p, err := NewPermutation(g, 42)
+			if err != nil {
+				t.Fatalf("NewPermutation() unexpected error = %v", err)
+			}
+
+			got := slices.Collect(p.All())
+			if uint64(len(got)) != p.Size() {
+				t.Errorf("Permutation.Size() = %v, All() yielded %v", p.Size(), len(got))
+			}
+
+			if again := slices.Collect(p.All()); !slices.Equal(got, again) {
+				t.Errorf("Permutation.All() = %v, then %v with the same seed", got, again)
+			}
+
+			want := slices.Collect(g.All())
+			slices.SortFunc(got, netip.Addr.Compare)
+			if !slices.Equal(got, want) {
+				t.Errorf("Permutation.All() sorted = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestPermutationOrder(t *testing.T) {
+	r := mustRange(t, "10.0.0.0", "10.0.255.255")
+
+	p1, err := NewPermutation(r, 1)
+	if err != nil {
+		t.Fatalf("NewPermutation() unexpected error = %v", err)
+	}
+	p2, err := NewPermutation(r, 2)
+	if err != nil {
+		t.Fatalf("NewPermutation() unexpected error = %v", err)
+	}
+
+	first := slices.Collect(p1.All())
+	if slices.Equal(first, slices.Collect(r.All())) {
+		t.Errorf("Permutation.All() kept the ascending order")
+	}
+	if slices.Equal(first, slices.Collect(p2.All())) {
+		t.Errorf("Permutation.All() gave the same order for seeds 1 and 2")
+	}
+
+	// consecutive addresses of the permutation should rarely share their /24
+	var same int
+	for i := 1; i < len(first); i++ {
+		if first[i].As4()[2] == first[i-1].As4()[2] {
+			same++
+		}
+	}
+	if same > len(first)/64 {
+		t.Errorf("Permutation.All() kept %d of %d consecutive addresses in the same /24", same, len(first))
+	}
+}
+
+// unindexed is a Generator without random access
+type unindexed struct{ r Range }
+
+func (u unindexed) All() iter.Seq[netip.Addr] { return u.r.All() }
+
+func (u unindexed) Size() uint64 { return u.r.Size() }
+
+func TestNewPermutationErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		g    Generator
+	}{
+		{name: "not indexed", g: unindexed{mustRange(t, "10.0.0.0", "10.0.0.255")}},
+		{name: "chain not indexed", g: Chain{mustRange(t, "10.0.0.0", "10.0.0.255"), unindexed{mustRange(t, "10.0.1.0", "10.0.1.255")}}},
+		{name: "too large", g: mustRange(t, "2001:db8::", "2001:db9::")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewPermutation(tt.g, 1); err == nil {
+				t.Errorf("NewPermutation() expected error")
+			}
+		})
+	}
+}
+
+func TestIDOf(t *testing.T) {
+	ids := make(map[string]string)
+	for name, g := range indexedGenerators(t) {
+		id, ok := IDOf(g)
+		if !ok {
+			t.Errorf("IDOf(%s) has no ID", name)
+		}
+		if other, dup := ids[id]; dup {
+			t.Errorf("IDOf(%s) = IDOf(%s) = %q", name, other, id)
+		}
+		ids[id] = name
+	}
+
+	r := mustRange(t, "10.0.0.0", "10.0.0.255")
+	for name, g := range map[string]Generator{
+		"unidentified":       unindexed{r},
+		"chain unidentified": Chain{r, unindexed{r}},
+		"shard unidentified": Shard{Hosts: unindexed{r}, Index: 0, Count: 2},
+	} {
+		if id, ok := IDOf(g); ok {
+			t.Errorf("IDOf(%s) = %q, want no ID", name, id)
+		}
+	}
+}
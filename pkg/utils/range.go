@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"encoding/binary"
+	"fmt"
+	"iter"
+	"math"
+	"math/bits"
+	"net"
+	"net/netip"
+)
+
+// Generator enumerates the addresses to scan
+type Generator interface {
+	// All returns a lazy iterator over the addresses
+	All() iter.Seq[netip.Addr]
+	// Size returns the number of addresses All yields
+	Size() uint64
+}
+
+// Identified is a Generator with an ID, generators with the same ID yield
+// the same addresses in the same order
+type Identified interface {
+	Generator
+	// ID describes the addresses and their order, it is empty when a
+	// generator wrapped has no ID
+	ID() string
+}
+
+// IDOf returns the ID of g, false when g or a generator it wraps has none
+func IDOf(g Generator) (string, bool) {
+	if g, ok := g.(Identified); ok {
+		id := g.ID()
+		return id, id != ""
+	}
+	return "", false
+}
+
+// Range is an inclusive span of IP addresses going from Start to End
+type Range struct {
+	Start netip.Addr
+	End   netip.Addr
+}
+
+// NewRange returns the range going exactly from start to end, both included
+func NewRange(start, end net.IP) (Range, error) {
+	s, ok := netip.AddrFromSlice(start)
+	if !ok {
+		return Range{}, fmt.Errorf("invalid IP: %v", start)
+	}
+
+	e, ok := netip.AddrFromSlice(end)
+	if !ok {
+		return Range{}, fmt.Errorf("invalid IP: %v", end)
+	}
+
+	s, e = s.Unmap(), e.Unmap()
+
+	if s.Is4() != e.Is4() {
+		return Range{}, fmt.Errorf("invalid range: start and end IP must be of the same family")
+	}
+
+	if e.Less(s) {
+		return Range{}, fmt.Errorf("invalid range: end IP must be greater than start IP")
+	}
+
+	return Range{Start: s, End: e}, nil
+}
+
+// Size returns the number of addresses in the range.
+// IPv6 ranges holding more than 2^64-1 addresses saturate at math.MaxUint64.
+func (r Range) Size() uint64 {
+	if !r.Start.IsValid() || !r.End.IsValid() {
+		return 0
+	}
+
+	shi, slo := addrToUint128(r.Start)
+	ehi, elo := addrToUint128(r.End)
+
+	lo, borrow := bits.Sub64(elo, slo, 0)
+	hi, _ := bits.Sub64(ehi, shi, borrow)
+	if hi != 0 || lo == math.MaxUint64 {
+		return math.MaxUint64
+	}
+	return lo + 1
+}
+
+// Contains reports whether ip falls inside the range
+func (r Range) Contains(ip netip.Addr) bool {
+	return r.Start.Compare(ip) <= 0 && ip.Compare(r.End) <= 0
+}
+
+// All returns an iterator over every address of the range, in ascending order.
+// Addresses are generated lazily so memory stays flat whatever the range size.
+func (r Range) All() iter.Seq[netip.Addr] {
+	return func(yield func(netip.Addr) bool) {
+		if r.Size() == 0 {
+			return
+		}
+
+		for currentIP := r.Start; ; currentIP = currentIP.Next() {
+			if !yield(currentIP) || currentIP == r.End {
+				return
+			}
+		}
+	}
+}
+
+// Index returns a function mapping a position below Size to its address
+func (r Range) Index() func(i uint64) netip.Addr {
+	hi, lo := addrToUint128(r.Start)
+	is4 := r.Start.Is4()
+	return func(i uint64) netip.Addr {
+		lo, carry := bits.Add64(lo, i, 0)
+		ip := uint128ToAddr(hi+carry, lo)
+		if is4 {
+			return ip.Unmap()
+		}
+		return ip
+	}
+}
+
+// ID describes the range
+func (r Range) ID() string {
+	return "range(" + r.String() + ")"
+}
+
+// String returns the range in start-end form
+func (r Range) String() string {
+	return fmt.Sprintf("%v-%v", r.Start, r.End)
+}
+
+// addrToUint128 splits the 16 bytes form of an address into its high and low halves
+func addrToUint128(a netip.Addr) (hi, lo uint64) {
+	b := a.As16()
+	return binary.BigEndian.Uint64(b[:8]), binary.BigEndian.Uint64(b[8:])
+}
+
+// uint128ToAddr builds an IPv6 address from its high and low halves
+func uint128ToAddr(hi, lo uint64) netip.Addr {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], hi)
+	binary.BigEndian.PutUint64(b[8:], lo)
+	return netip.AddrFrom16(b)
+}
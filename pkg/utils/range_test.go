@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"math"
+	"net"
+	"testing"
+)
+
+func TestNewRange(t *testing.T) {
+	tests := []struct {
+		name     string
+		start    string
+		end      string
+		wantSize uint64
+		wantErr  bool
+	}{
+		{
+			name:     "partial /24",
+			start:    "10.0.0.5",
+			end:      "10.0.0.20",
+			wantSize: 16,
+		},
+		{
+			name:     "across /24 boundary",
+			start:    "10.0.0.5",
+			end:      "10.0.1.20",
+			wantSize: 272,
+		},
+		{
+			name:     "across /8 boundary",
+			start:    "9.255.255.255",
+			end:      "10.0.0.0",
+			wantSize: 2,
+		},
+		{
+			name:     "single address",
+			start:    "192.168.1.1",
+			end:      "192.168.1.1",
+			wantSize: 1,
+		},
+		{
+			name:     "IPv6 /120",
+			start:    "2001:db8::",
+			end:      "2001:db8::ff",
+			wantSize: 256,
+		},
+		{
+			name:     "IPv6 whole space saturates",
+			start:    "::",
+			end:      "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff",
+			wantSize: math.MaxUint64,
+		},
+		{
+			name:    "end before start",
+			start:   "10.0.1.0",
+			end:     "10.0.0.255",
+			wantErr: true,
+		},
+		{
+			name:    "mixed families",
+			start:   "10.0.0.0",
+			end:     "2001:db8::1",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRange(net.ParseIP(tt.start), net.ParseIP(tt.end))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewRange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := r.Size(); got != tt.wantSize {
+				t.Errorf("Range.Size() = %v, want %v", got, tt.wantSize)
+			}
+		})
+	}
+}
+
+func TestRangeAll(t *testing.T) {
+	r, err := NewRange(net.ParseIP("10.0.0.254"), net.ParseIP("10.0.1.1"))
+	if err != nil {
+		t.Fatalf("NewRange() unexpected error = %v", err)
+	}
+
+	want := []string{"10.0.0.254", "10.0.0.255", "10.0.1.0", "10.0.1.1"}
+	var got []string
+	for ip := range r.All() {
+		got = append(got, ip.String())
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Range.All() yielded %d hosts, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Range.All()[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestRangeAllBreak(t *testing.T) {
+	// A /8 must be walkable lazily, stopping early without generating the rest
+	r, err := NewRange(net.ParseIP("10.0.0.0"), net.ParseIP("10.255.255.255"))
+	if err != nil {
+		t.Fatalf("NewRange() unexpected error = %v", err)
+	}
+
+	count := 0
+	for range r.All() {
+		count++
+		if count == 3 {
+			break
+		}
+	}
+	if count != 3 {
+		t.Errorf("Range.All() yielded %d hosts before break, want 3", count)
+	}
+}
+
+func TestRangeAllLastAddress(t *testing.T) {
+	// Walking up to the last IPv4 address must not wrap around
+	r, err := NewRange(net.ParseIP("255.255.255.254"), net.ParseIP("255.255.255.255"))
+	if err != nil {
+		t.Fatalf("NewRange() unexpected error = %v", err)
+	}
+
+	count := 0
+	for range r.All() {
+		count++
+	}
+	if count != 2 {
+		t.Errorf("Range.All() yielded %d hosts, want 2", count)
+	}
+}
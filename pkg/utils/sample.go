@@ -0,0 +1,231 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+	"math"
+	"math/bits"
+	"net/netip"
+	"sort"
+)
+
+// Sample yields Count addresses spread over Hosts: the positions of Hosts
+// are cut into Count strata of equal size and one address is drawn at random
+// in each, so the sample follows the layout of the range
+type Sample struct {
+	Hosts Indexed
+	Count uint64
+	Seed  uint64
+}
+
+// NewSample returns a sample of the given share, from 0 excluded to 1, of
+// the addresses of g
+func NewSample(g Generator, rate float64, seed uint64) (Sample, error) {
+	if !(rate > 0 && rate <= 1) {
+		return Sample{}, fmt.Errorf("invalid sample rate %v: must be greater than 0 and at most 1", rate)
+	}
+	if !isIndexed(g) {
+		return Sample{}, fmt.Errorf("cannot sample the addresses of %T", g)
+	}
+
+	n := g.Size()
+	if n == math.MaxUint64 {
+		return Sample{}, errors.New("too many addresses to sample")
+	}
+
+	count := min(uint64(math.Ceil(float64(n)*rate)), n)
+	return Sample{Hosts: g.(Indexed), Count: count, Seed: seed}, nil
+}
+
+// ID describes the sampled addresses, empty when Hosts has no ID
+func (s Sample) ID() string {
+	hosts, ok := IDOf(s.Hosts)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("sample(%s, %d, %d)", hosts, s.Count, s.Seed)
+}
+
+// All returns an iterator over the sampled addresses, in the order of Hosts
+func (s Sample) All() iter.Seq[netip.Addr] {
+	return func(yield func(netip.Addr) bool) {
+		at := s.Index()
+		for i := range s.Count {
+			if !yield(at(i)) {
+				return
+			}
+		}
+	}
+}
+
+// Size returns the number of sampled addresses
+func (s Sample) Size() uint64 {
+	return s.Count
+}
+
+// Index returns a function mapping a position below Size to its address
+func (s Sample) Index() func(i uint64) netip.Addr {
+	at := s.Hosts.Index()
+	n := s.Hosts.Size()
+
+	// stratum returns the position of the first address of the k-th stratum
+	stratum := func(k uint64) uint64 {
+		hi, lo := bits.Mul64(n, k)
+		q, _ := bits.Div64(hi, lo, s.Count)
+		return q
+	}
+
+	return func(i uint64) netip.Addr {
+		first, next := stratum(i), stratum(i+1)
+		return at(first + mix64(s.Seed^mix64(i))%(next-first))
+	}
+}
+
+// BlockSample yields up to PerBlock addresses of every /24 of Hosts, drawn
+// at random among the addresses of Hosts in the /24. Hosts must yield IPv4
+// addresses in ascending order.
+type BlockSample struct {
+	Hosts    Indexed
+	PerBlock int
+	Seed     uint64
+	// blocks are the /24s of Hosts, in order
+	blocks []sampleBlock
+	size   uint64
+}
+
+// sampleBlock is a /24 of the addresses of a BlockSample
+type sampleBlock struct {
+	// base is the first address of the /24
+	base uint32
+	// first is the position in Hosts of the first address in the /24
+	first uint64
+	// count is the number of addresses of Hosts in the /24
+	count uint64
+	// offset is the position in the sample of the first address drawn in the /24
+	offset uint64
+}
+
+// NewBlockSample returns a sample of perBlock addresses of every /24 of g
+func NewBlockSample(g Generator, perBlock int, seed uint64) (BlockSample, error) {
+	if perBlock <= 0 || perBlock > 256 {
+		return BlockSample{}, fmt.Errorf("invalid sample of %d addresses per /24: must be from 1 to 256", perBlock)
+	}
+	if !isIndexed(g) {
+		return BlockSample{}, fmt.Errorf("cannot sample the addresses of %T", g)
+	}
+
+	s := BlockSample{Hosts: g.(Indexed), PerBlock: perBlock, Seed: seed}
+
+	var pos uint64
+	for ip := range g.All() {
+		if !ip.Is4() {
+			return BlockSample{}, fmt.Errorf("cannot sample %v per /24, only IPv4 addresses can be", ip)
+		}
+
+		base := addrToUint32(ip) &^ 0xff
+		if n := len(s.blocks); n == 0 || s.blocks[n-1].base != base {
+			s.blocks = append(s.blocks, sampleBlock{base: base, first: pos, offset: s.size})
+		}
+
+		b := &s.blocks[len(s.blocks)-1]
+		if b.count < uint64(perBlock) {
+			s.size++
+		}
+		b.count++
+		pos++
+	}
+	return s, nil
+}
+
+// ID describes the sampled addresses, empty when Hosts has no ID
+func (s BlockSample) ID() string {
+	hosts, ok := IDOf(s.Hosts)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("blocksample(%s, %d, %d)", hosts, s.PerBlock, s.Seed)
+}
+
+// All returns an iterator over the sampled addresses, a /24 after the other
+func (s BlockSample) All() iter.Seq[netip.Addr] {
+	return func(yield func(netip.Addr) bool) {
+		at := s.Hosts.Index()
+		for _, b := range s.blocks {
+			drawn := s.draw(b)
+			for w, word := range drawn {
+				for ; word != 0; word &= word - 1 {
+					if !yield(at(b.first + uint64(64*w+bits.TrailingZeros64(word)))) {
+						return
+					}
+				}
+			}
+		}
+	}
+}
+
+// Size returns the number of sampled addresses
+func (s BlockSample) Size() uint64 {
+	return s.size
+}
+
+// Index returns a function mapping a position below Size to its address. The
+// draw of the last /24 looked up is kept, so the function must not be called
+// concurrently.
+func (s BlockSample) Index() func(i uint64) netip.Addr {
+	at := s.Hosts.Index()
+	last := -1
+	var drawn blockDraw
+	return func(i uint64) netip.Addr {
+		k := sort.Search(len(s.blocks), func(k int) bool { return s.blocks[k].offset > i }) - 1
+		b := s.blocks[k]
+		if k != last {
+			last, drawn = k, s.draw(b)
+		}
+		return at(b.first + drawn.nth(i-b.offset))
+	}
+}
+
+// blockDraw is the set of the addresses drawn in a /24, bit j standing for
+// the j-th address of Hosts in the /24
+type blockDraw [4]uint64
+
+// nth returns the offset in the /24 of the n-th address drawn
+func (d blockDraw) nth(n uint64) uint64 {
+	for w, word := range d {
+		if c := uint64(bits.OnesCount64(word)); n >= c {
+			n -= c
+			continue
+		}
+		for ; n > 0; n-- {
+			word &= word - 1
+		}
+		return uint64(64*w + bits.TrailingZeros64(word))
+	}
+	panic("utils: position out of the draw of the /24")
+}
+
+// draw returns the addresses drawn in the /24 b, the same ones for a given
+// seed. It neither allocates nor sorts, the positions are kept as a bitmap.
+func (s BlockSample) draw(b sampleBlock) blockDraw {
+	var d blockDraw
+	k := min(uint64(s.PerBlock), b.count)
+	if k == b.count {
+		for j := range b.count {
+			d[j/64] |= 1 << (j % 64)
+		}
+		return d
+	}
+
+	// partial Fisher-Yates shuffle of the offsets of the /24
+	var offsets [256]uint8
+	for j := range b.count {
+		offsets[j] = uint8(j)
+	}
+	for i := range k {
+		j := i + mix64(s.Seed^uint64(b.base)^mix64(i))%(b.count-i)
+		offsets[i], offsets[j] = offsets[j], offsets[i]
+		d[offsets[i]/64] |= 1 << (offsets[i] % 64)
+	}
+	return d
+}
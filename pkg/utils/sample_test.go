@@ -0,0 +1,172 @@
+package utils
+
+import (
+	"math"
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+func TestSample(t *testing.T) {
+	hosts := MergeRanges([]Range{mustRange(t, "10.0.0.0", "10.0.255.255"), mustRange(t, "10.2.0.0", "10.2.0.99")})
+
+	tests := []struct {
+		rate     float64
+		wantSize uint64
+	}{
+		{rate: 0.01, wantSize: 657},
+		{rate: 0.5, wantSize: 32818},
+		{rate: 1, wantSize: 65636},
+		{rate: 1e-9, wantSize: 1},
+	}
+
+	for _, tt := range tests {
+		s, err := NewSample(hosts, tt.rate, 7)
+		if err != nil {
+			t.Fatalf("NewSample(%v) unexpected error = %v", tt.rate, err)
+		}
+
+		got := slices.Collect(s.All())
+		if uint64(len(got)) != tt.wantSize || s.Size() != tt.wantSize {
+			t.Errorf("NewSample(%v) yielded %v addresses, Size() = %v, want %v", tt.rate, len(got), s.Size(), tt.wantSize)
+		}
+		if !slices.IsSortedFunc(got, netip.Addr.Compare) || len(slices.Compact(slices.Clone(got))) != len(got) {
+			t.Errorf("NewSample(%v) yielded unsorted or duplicate addresses", tt.rate)
+		}
+		for _, ip := range got {
+			if !hosts[0].Contains(ip) && !hosts[1].Contains(ip) {
+				t.Errorf("NewSample(%v) yielded %v outside of the hosts", tt.rate, ip)
+			}
+		}
+
+		at := s.Index()
+		for i, ip := range got {
+			if at(uint64(i)) != ip {
+				t.Errorf("Sample.Index()(%d) = %v, want %v", i, at(uint64(i)), ip)
+			}
+		}
+	}
+
+	// a 1% sample draws one address in each block of 100
+	s, err := NewSample(mustRange(t, "10.0.0.0", "10.0.3.231"), 0.01, 3)
+	if err != nil {
+		t.Fatalf("NewSample() unexpected error = %v", err)
+	}
+	var i uint32
+	for ip := range s.All() {
+		if n := addrToUint32(ip) - addrToUint32(netip.MustParseAddr("10.0.0.0")); n/100 != i {
+			t.Errorf("NewSample() drew %v in block %d, want block %d", ip, n/100, i)
+		}
+		i++
+	}
+
+	other, err := NewSample(mustRange(t, "10.0.0.0", "10.0.3.231"), 0.01, 4)
+	if err != nil {
+		t.Fatalf("NewSample() unexpected error = %v", err)
+	}
+	if slices.Equal(slices.Collect(s.All()), slices.Collect(other.All())) {
+		t.Errorf("NewSample() drew the same addresses with seeds 3 and 4")
+	}
+}
+
+func TestNewSampleErrors(t *testing.T) {
+	r := mustRange(t, "10.0.0.0", "10.0.0.255")
+	for _, rate := range []float64{0, -0.5, 1.5, math.NaN()} {
+		if _, err := NewSample(r, rate, 1); err == nil {
+			t.Errorf("NewSample(%v) expected error", rate)
+		}
+	}
+	if _, err := NewSample(unindexed{r}, 0.5, 1); err == nil {
+		t.Errorf("NewSample() of an unindexed generator expected error")
+	}
+}
+
+func TestBlockSample(t *testing.T) {
+	hosts := NewLastByteFilter(
+		MergeRanges([]Range{mustRange(t, "10.0.0.0", "10.0.2.255"), mustRange(t, "10.0.5.10", "10.0.5.11"), mustRange(t, "10.0.5.250", "10.0.6.3")}),
+		[]byte{0, 255},
+	)
+
+	s, err := NewBlockSample(hosts, 4, 11)
+	if err != nil {
+		t.Fatalf("NewBlockSample() unexpected error = %v", err)
+	}
+
+	got := slices.Collect(s.All())
+	perBlock := make(map[byte]int)
+	for _, ip := range got {
+		if b := ip.As4()[3]; b == 0 || b == 255 {
+			t.Errorf("BlockSample.All() yielded %v, skipped by its hosts", ip)
+		}
+		perBlock[ip.As4()[2]]++
+	}
+
+	// 10.0.5.0/24 holds 10.0.5.10, .11, .250 to .254
+	want := map[byte]int{0: 4, 1: 4, 2: 4, 5: 4, 6: 3}
+	for block, n := range want {
+		if perBlock[block] != n {
+			t.Errorf("BlockSample.All() yielded %v addresses in 10.0.%d.0/24, want %v", perBlock[block], block, n)
+		}
+	}
+	if uint64(len(got)) != s.Size() || s.Size() != 19 {
+		t.Errorf("BlockSample.Size() = %v, All() yielded %v, want 19", s.Size(), len(got))
+	}
+	if !slices.IsSortedFunc(got, netip.Addr.Compare) || len(slices.Compact(slices.Clone(got))) != len(got) {
+		t.Errorf("BlockSample.All() yielded unsorted or duplicate addresses")
+	}
+
+	at := s.Index()
+	for i, ip := range got {
+		if at(uint64(i)) != ip {
+			t.Errorf("BlockSample.Index()(%d) = %v, want %v", i, at(uint64(i)), ip)
+		}
+	}
+
+	again, err := NewBlockSample(hosts, 4, 11)
+	if err != nil {
+		t.Fatalf("NewBlockSample() unexpected error = %v", err)
+	}
+	if !slices.Equal(got, slices.Collect(again.All())) {
+		t.Errorf("NewBlockSample() drew other addresses with the same seed")
+	}
+}
+
+func TestBlockSampleIndex(t *testing.T) {
+	s, err := NewBlockSample(mustRange(t, "10.0.0.0", "10.0.255.255"), 200, 3)
+	if err != nil {
+		t.Fatalf("NewBlockSample() unexpected error = %v", err)
+	}
+	want := slices.Collect(s.All())
+
+	// positions out of order, hopping from a /24 to another
+	at := s.Index()
+	for _, i := range []uint64{5, 199, 200, 0, 12_799, 6_400, 6_399, 201} {
+		if at(i) != want[i] {
+			t.Errorf("BlockSample.Index()(%d) = %v, want %v", i, at(i), want[i])
+		}
+	}
+
+	i := uint64(0)
+	allocs := testing.AllocsPerRun(1000, func() {
+		at(i)
+		i = (i + 201) % s.Size()
+	})
+	if allocs != 0 {
+		t.Errorf("BlockSample.Index() allocated %v times per lookup, want 0", allocs)
+	}
+}
+
+func TestNewBlockSampleErrors(t *testing.T) {
+	r := mustRange(t, "10.0.0.0", "10.0.0.255")
+	for _, perBlock := range []int{0, -1, 257} {
+		if _, err := NewBlockSample(r, perBlock, 1); err == nil {
+			t.Errorf("NewBlockSample(%d) expected error", perBlock)
+		}
+	}
+	if _, err := NewBlockSample(mustRange(t, "2001:db8::", "2001:db8::ff"), 4, 1); err == nil {
+		t.Errorf("NewBlockSample() of IPv6 addresses expected error")
+	}
+	if _, err := NewBlockSample(unindexed{r}, 4, 1); err == nil {
+		t.Errorf("NewBlockSample() of an unindexed generator expected error")
+	}
+}
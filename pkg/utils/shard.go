@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+	"math/bits"
+	"net/netip"
+)
+
+// Shard yields one of Count consecutive slices of the addresses of Hosts,
+// Index is the 0-based slice. Shards of the same generator are disjoint and
+// together yield every address once.
+type Shard struct {
+	Hosts Generator
+	Index uint64
+	Count uint64
+}
+
+// NewShard returns the index-th of count slices of the addresses of g
+func NewShard(g Generator, index, count uint64) (Shard, error) {
+	if count == 0 || index >= count {
+		return Shard{}, errors.New("shard index must be below the number of shards")
+	}
+	return Shard{Hosts: g, Index: index, Count: count}, nil
+}
+
+// ID describes the slice of the addresses, empty when Hosts has no ID
+func (s Shard) ID() string {
+	hosts, ok := IDOf(s.Hosts)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("shard(%s, %d/%d)", hosts, s.Index, s.Count)
+}
+
+// All returns an iterator over the addresses of the shard, in the order of Hosts
+func (s Shard) All() iter.Seq[netip.Addr] {
+	return func(yield func(netip.Addr) bool) {
+		start, end := s.bounds()
+
+		// jump straight to the shard when the addresses can be read by position
+		if g, ok := s.Hosts.(Indexed); ok {
+			at := g.Index()
+			for i := start; i < end; i++ {
+				if !yield(at(i)) {
+					return
+				}
+			}
+			return
+		}
+
+		var i uint64
+		for ip := range s.Hosts.All() {
+			if i >= end {
+				return
+			}
+			if i >= start && !yield(ip) {
+				return
+			}
+			i++
+		}
+	}
+}
+
+// Size returns the number of addresses of the shard
+func (s Shard) Size() uint64 {
+	start, end := s.bounds()
+	return end - start
+}
+
+// bounds returns the positions of the first address of the shard and of the one following its last
+func (s Shard) bounds() (start, end uint64) {
+	return s.offset(s.Index), s.offset(s.Index + 1)
+}
+
+// offset returns the position where the k-th shard starts, n*k/Count
+// computed on 128 bits so it cannot overflow
+func (s Shard) offset(k uint64) uint64 {
+	hi, lo := bits.Mul64(s.Hosts.Size(), k)
+	q, _ := bits.Div64(hi, lo, s.Count)
+	return q
+}
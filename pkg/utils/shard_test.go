@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestShard(t *testing.T) {
+	r := mustRange(t, "10.0.0.0", "10.0.0.99")
+	p, err := NewPermutation(r, 3)
+	if err != nil {
+		t.Fatalf("NewPermutation() unexpected error = %v", err)
+	}
+
+	for name, g := range map[string]Generator{
+		"range":       r,
+		"permutation": p,
+		"unindexed":   unindexed{r},
+		"empty":       Ranges{},
+	} {
+		for count := uint64(1); count <= 7; count++ {
+			var got []string
+			for index := range count {
+				s, err := NewShard(g, index, count)
+				if err != nil {
+					t.Fatalf("NewShard() unexpected error = %v", err)
+				}
+
+				var n uint64
+				for ip := range s.All() {
+					got = append(got, ip.String())
+					n++
+				}
+				if n != s.Size() {
+					t.Errorf("%s: Shard(%d/%d).Size() = %v, All() yielded %v", name, index, count, s.Size(), n)
+				}
+				if want := g.Size() / count; n != want && n != want+1 {
+					t.Errorf("%s: Shard(%d/%d) yielded %v addresses, want %v or %v", name, index, count, n, want, want+1)
+				}
+			}
+
+			var want []string
+			for ip := range g.All() {
+				want = append(want, ip.String())
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("%s: %d shards yielded %v, want %v", name, count, got, want)
+			}
+		}
+	}
+}
+
+func TestNewShardErrors(t *testing.T) {
+	r := mustRange(t, "10.0.0.0", "10.0.0.99")
+	for _, tt := range []struct{ index, count uint64 }{{0, 0}, {2, 2}, {5, 3}} {
+		if _, err := NewShard(r, tt.index, tt.count); err == nil {
+			t.Errorf("NewShard(%d, %d) expected error", tt.index, tt.count)
+		}
+	}
+}
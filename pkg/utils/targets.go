@@ -0,0 +1,242 @@
+package utils
+
+import (
+	"fmt"
+	"iter"
+	"math"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// Ranges is a set of addresses held as sorted, disjoint ranges, IPv4
+// ranges come first
+type Ranges []Range
+
+// MergeRanges returns the set of the addresses of rs, overlapping and
+// adjacent ranges are merged so no address is yielded twice
+func MergeRanges(rs []Range) Ranges {
+	sorted := slices.Clone(rs)
+	slices.SortFunc(sorted, func(a, b Range) int {
+		return a.Start.Compare(b.Start)
+	})
+
+	var merged Ranges
+	for _, r := range sorted {
+		if n := len(merged); n > 0 {
+			last := &merged[n-1]
+			// the next address of the last one of a family is invalid, never r.Start
+			if r.Start.Compare(last.End) <= 0 || last.End.Next() == r.Start {
+				if last.End.Less(r.End) {
+					last.End = r.End
+				}
+				continue
+			}
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// Subtract returns the addresses of rs that are not in excluded
+func (rs Ranges) Subtract(excluded Ranges) Ranges {
+	var out Ranges
+	first := 0
+	for _, r := range rs {
+		// exclusions are sorted, the ones ending before r end before the next ranges too
+		for first < len(excluded) && excluded[first].End.Less(r.Start) {
+			first++
+		}
+
+		start, covered := r.Start, false
+		for _, e := range excluded[first:] {
+			if r.End.Less(e.Start) {
+				break
+			}
+			if start.Less(e.Start) {
+				out = append(out, Range{Start: start, End: e.Start.Prev()})
+			}
+			if !e.End.Less(r.End) {
+				covered = true
+				break
+			}
+			start = e.End.Next()
+		}
+
+		if !covered {
+			out = append(out, Range{Start: start, End: r.End})
+		}
+	}
+	return out
+}
+
+// Size returns the number of addresses of the set, saturating at math.MaxUint64
+func (rs Ranges) Size() uint64 {
+	var total uint64
+	for _, r := range rs {
+		size := r.Size()
+		if size > math.MaxUint64-total {
+			return math.MaxUint64
+		}
+		total += size
+	}
+	return total
+}
+
+// All returns an iterator over every address of the set, in ascending order
+func (rs Ranges) All() iter.Seq[netip.Addr] {
+	return func(yield func(netip.Addr) bool) {
+		for _, r := range rs {
+			for ip := range r.All() {
+				if !yield(ip) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Index returns a function mapping a position below Size to its address
+func (rs Ranges) Index() func(i uint64) netip.Addr {
+	sizes := make([]uint64, len(rs))
+	index := make([]func(uint64) netip.Addr, len(rs))
+	for k, r := range rs {
+		sizes[k], index[k] = r.Size(), r.Index()
+	}
+	return indexParts(sizes, index)
+}
+
+// ID describes the ranges
+func (rs Ranges) ID() string {
+	return "ranges(" + rs.String() + ")"
+}
+
+// String returns the comma separated ranges of the set
+func (rs Ranges) String() string {
+	parts := make([]string, 0, len(rs))
+	for _, r := range rs {
+		parts = append(parts, r.String())
+	}
+	return strings.Join(parts, ",")
+}
+
+// ParseTarget parses a CIDR prefix, a start-end range or a single IP
+func ParseTarget(s string) (Range, error) {
+	s = strings.TrimSpace(s)
+
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return Range{}, fmt.Errorf("invalid CIDR notation %q: %w", s, err)
+		}
+		return PrefixRange(p), nil
+	}
+
+	if start, end, ok := strings.Cut(s, "-"); ok {
+		first, err := netip.ParseAddr(strings.TrimSpace(start))
+		if err != nil {
+			return Range{}, fmt.Errorf("invalid range %q: %w", s, err)
+		}
+		last, err := netip.ParseAddr(strings.TrimSpace(end))
+		if err != nil {
+			return Range{}, fmt.Errorf("invalid range %q: %w", s, err)
+		}
+		return NewRange(first.AsSlice(), last.AsSlice())
+	}
+
+	ip, err := netip.ParseAddr(s)
+	if err != nil {
+		return Range{}, fmt.Errorf("invalid target %q: must be a CIDR, a start-end range or an IP", s)
+	}
+	ip = ip.Unmap()
+	return Range{Start: ip, End: ip}, nil
+}
+
+// HostRange returns the range of the host addresses of p: an IPv4 prefix
+// loses its network and broadcast addresses, except a /31 point-to-point
+// link or a /32 host which have none
+func HostRange(p netip.Prefix) Range {
+	r := PrefixRange(p)
+	if r.Start.Is4() && p.Bits() <= 30 {
+		r.Start, r.End = r.Start.Next(), r.End.Prev()
+	}
+	return r
+}
+
+// PrefixRange returns the range of every address of p
+func PrefixRange(p netip.Prefix) Range {
+	p = p.Masked()
+	start := p.Addr()
+
+	// shifting by the width or more gives 0 so /32 and /128 get no host bits
+	if start.Is4() {
+		b := start.As4()
+		host := uint32(math.MaxUint32) >> p.Bits()
+		for i := range b {
+			b[i] |= byte(host >> (24 - 8*i))
+		}
+		return Range{Start: start, End: netip.AddrFrom4(b)}
+	}
+
+	hi, lo := addrToUint128(start)
+	if bits := p.Bits(); bits < 64 {
+		hi |= math.MaxUint64 >> bits
+		lo = math.MaxUint64
+	} else {
+		lo |= math.MaxUint64 >> (bits - 64)
+	}
+	return Range{Start: start, End: uint128ToAddr(hi, lo)}
+}
+
+// Chain yields the addresses of its generators one after the other
+type Chain []Generator
+
+// All returns an iterator over the addresses of every generator, in order
+func (c Chain) All() iter.Seq[netip.Addr] {
+	return func(yield func(netip.Addr) bool) {
+		for _, g := range c {
+			for ip := range g.All() {
+				if !yield(ip) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Size returns the number of addresses of every generator, saturating at math.MaxUint64
+func (c Chain) Size() uint64 {
+	var total uint64
+	for _, g := range c {
+		size := g.Size()
+		if size > math.MaxUint64-total {
+			return math.MaxUint64
+		}
+		total += size
+	}
+	return total
+}
+
+// Index returns a function mapping a position below Size to its address,
+// every generator of the chain must be Indexed
+func (c Chain) Index() func(i uint64) netip.Addr {
+	sizes := make([]uint64, len(c))
+	index := make([]func(uint64) netip.Addr, len(c))
+	for k, g := range c {
+		sizes[k], index[k] = g.Size(), g.(Indexed).Index()
+	}
+	return indexParts(sizes, index)
+}
+
+// ID describes the generators of the chain, empty when one of them has no ID
+func (c Chain) ID() string {
+	ids := make([]string, len(c))
+	for k, g := range c {
+		id, ok := IDOf(g)
+		if !ok {
+			return ""
+		}
+		ids[k] = id
+	}
+	return "chain(" + strings.Join(ids, ", ") + ")"
+}
@@ -0,0 +1,262 @@
+package utils
+
+import (
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		target    string
+		wantStart string
+		wantEnd   string
+		wantErr   bool
+	}{
+		{target: "10.0.0.0/24", wantStart: "10.0.0.0", wantEnd: "10.0.0.255"},
+		{target: "10.0.0.7/30", wantStart: "10.0.0.4", wantEnd: "10.0.0.7"},
+		{target: "10.0.0.1/32", wantStart: "10.0.0.1", wantEnd: "10.0.0.1"},
+		{target: "0.0.0.0/0", wantStart: "0.0.0.0", wantEnd: "255.255.255.255"},
+		{target: "2001:db8::/64", wantStart: "2001:db8::", wantEnd: "2001:db8::ffff:ffff:ffff:ffff"},
+		{target: "2001:db8::/120", wantStart: "2001:db8::", wantEnd: "2001:db8::ff"},
+		{target: "2001:db8::/32", wantStart: "2001:db8::", wantEnd: "2001:db8:ffff:ffff:ffff:ffff:ffff:ffff"},
+		{target: "10.0.0.5-10.0.0.9", wantStart: "10.0.0.5", wantEnd: "10.0.0.9"},
+		{target: "10.0.0.5 - 10.0.0.9", wantStart: "10.0.0.5", wantEnd: "10.0.0.9"},
+		{target: "2001:db8::1-2001:db8::5", wantStart: "2001:db8::1", wantEnd: "2001:db8::5"},
+		{target: "  192.0.2.1 ", wantStart: "192.0.2.1", wantEnd: "192.0.2.1"},
+		{target: "::ffff:192.0.2.1", wantStart: "192.0.2.1", wantEnd: "192.0.2.1"},
+		{target: "10.0.0.9-10.0.0.5", wantErr: true},
+		{target: "10.0.0.1-2001:db8::1", wantErr: true},
+		{target: "10.0.0.0/33", wantErr: true},
+		{target: "10.0.0.1-", wantErr: true},
+		{target: "example.com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			got, err := ParseTarget(tt.target)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTarget() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Start.String() != tt.wantStart || got.End.String() != tt.wantEnd {
+				t.Errorf("ParseTarget() = %v, want %v-%v", got, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestMergeRanges(t *testing.T) {
+	parse := func(targets ...string) []Range {
+		var rs []Range
+		for _, target := range targets {
+			r, err := ParseTarget(target)
+			if err != nil {
+				t.Fatalf("ParseTarget(%q) unexpected error = %v", target, err)
+			}
+			rs = append(rs, r)
+		}
+		return rs
+	}
+
+	tests := []struct {
+		name     string
+		targets  []string
+		want     string
+		wantSize uint64
+	}{
+		{
+			name:     "disjoint",
+			targets:  []string{"10.0.1.0/24", "10.0.0.0/28"},
+			want:     "10.0.0.0-10.0.0.15,10.0.1.0-10.0.1.255",
+			wantSize: 272,
+		},
+		{
+			name:     "overlapping",
+			targets:  []string{"10.0.0.0/24", "10.0.0.128-10.0.1.10", "10.0.0.5"},
+			want:     "10.0.0.0-10.0.1.10",
+			wantSize: 267,
+		},
+		{
+			name:     "adjacent",
+			targets:  []string{"10.0.0.0/25", "10.0.0.128/25"},
+			want:     "10.0.0.0-10.0.0.255",
+			wantSize: 256,
+		},
+		{
+			name:     "contained",
+			targets:  []string{"10.0.0.10-10.0.0.20", "10.0.0.0/24"},
+			want:     "10.0.0.0-10.0.0.255",
+			wantSize: 256,
+		},
+		{
+			name:     "duplicates",
+			targets:  []string{"192.0.2.1", "192.0.2.1", "192.0.2.1"},
+			want:     "192.0.2.1-192.0.2.1",
+			wantSize: 1,
+		},
+		{
+			name:     "mixed families",
+			targets:  []string{"2001:db8::/126", "255.255.255.255", "::/126"},
+			want:     "255.255.255.255-255.255.255.255,::-::3,2001:db8::-2001:db8::3",
+			wantSize: 9,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MergeRanges(parse(tt.targets...))
+			if got.String() != tt.want {
+				t.Errorf("MergeRanges() = %v, want %v", got, tt.want)
+			}
+			if got.Size() != tt.wantSize {
+				t.Errorf("Ranges.Size() = %v, want %v", got.Size(), tt.wantSize)
+			}
+
+			var n uint64
+			var prev netip.Addr
+			for ip := range got.All() {
+				if n > 0 && ip.Compare(prev) <= 0 {
+					t.Fatalf("Ranges.All() yielded %v after %v", ip, prev)
+				}
+				prev = ip
+				n++
+			}
+			if n != tt.wantSize {
+				t.Errorf("Ranges.All() yielded %v addresses, want %v", n, tt.wantSize)
+			}
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	r := mustRange(t, "2001:db8::", "2001:db8:0:1::ffff")
+	chain := Chain{
+		MergeRanges([]Range{mustRange(t, "10.0.0.1", "10.0.0.2")}),
+		NewSparse(r, LowByteIIDs(2)),
+	}
+
+	var got []string
+	for ip := range chain.All() {
+		got = append(got, ip.String())
+	}
+
+	want := []string{"10.0.0.1", "10.0.0.2", "2001:db8::1", "2001:db8::2", "2001:db8:0:1::1", "2001:db8:0:1::2"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Chain.All() = %v, want %v", got, want)
+	}
+	if chain.Size() != uint64(len(want)) {
+		t.Errorf("Chain.Size() = %v, want %v", chain.Size(), len(want))
+	}
+}
+
+func TestRangesSubtract(t *testing.T) {
+	merge := func(targets ...string) Ranges {
+		var rs []Range
+		for _, target := range targets {
+			r, err := ParseTarget(target)
+			if err != nil {
+				t.Fatalf("ParseTarget(%q) unexpected error = %v", target, err)
+			}
+			rs = append(rs, r)
+		}
+		return MergeRanges(rs)
+	}
+
+	tests := []struct {
+		name     string
+		targets  []string
+		excluded []string
+		want     string
+	}{
+		{
+			name:     "nothing excluded",
+			targets:  []string{"10.0.0.0/24"},
+			excluded: nil,
+			want:     "10.0.0.0-10.0.0.255",
+		},
+		{
+			name:     "hole in the middle",
+			targets:  []string{"10.0.0.0/24"},
+			excluded: []string{"10.0.0.16/28"},
+			want:     "10.0.0.0-10.0.0.15,10.0.0.32-10.0.0.255",
+		},
+		{
+			name:     "head and tail",
+			targets:  []string{"10.0.0.0/24"},
+			excluded: []string{"9.0.0.0-10.0.0.9", "10.0.0.250-11.0.0.0"},
+			want:     "10.0.0.10-10.0.0.249",
+		},
+		{
+			name:     "several holes",
+			targets:  []string{"10.0.0.0/24"},
+			excluded: []string{"10.0.0.1", "10.0.0.3", "10.0.0.5-10.0.0.254"},
+			want:     "10.0.0.0-10.0.0.0,10.0.0.2-10.0.0.2,10.0.0.4-10.0.0.4,10.0.0.255-10.0.0.255",
+		},
+		{
+			name:     "exclusion spanning targets",
+			targets:  []string{"10.0.0.0/24", "10.0.2.0/24", "10.0.4.0/24"},
+			excluded: []string{"10.0.0.128-10.0.2.127"},
+			want:     "10.0.0.0-10.0.0.127,10.0.2.128-10.0.2.255,10.0.4.0-10.0.4.255",
+		},
+		{
+			name:     "whole target",
+			targets:  []string{"10.0.0.0/24", "10.0.1.0/24"},
+			excluded: []string{"10.0.0.0/24"},
+			want:     "10.0.1.0-10.0.1.255",
+		},
+		{
+			name:     "everything",
+			targets:  []string{"10.0.0.0/24"},
+			excluded: []string{"0.0.0.0/0"},
+			want:     "",
+		},
+		{
+			name:     "other family untouched",
+			targets:  []string{"10.0.0.0/30", "2001:db8::/126"},
+			excluded: []string{"::/0"},
+			want:     "10.0.0.0-10.0.0.3",
+		},
+		{
+			name:     "IPv6",
+			targets:  []string{"2001:db8::/120"},
+			excluded: []string{"2001:db8::80/121"},
+			want:     "2001:db8::-2001:db8::7f",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targets := merge(tt.targets...)
+			got := targets.Subtract(merge(tt.excluded...))
+			if got.String() != tt.want {
+				t.Errorf("Ranges.Subtract() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHostRange(t *testing.T) {
+	tests := []struct {
+		prefix string
+		want   string
+	}{
+		{prefix: "10.0.0.0/24", want: "10.0.0.1-10.0.0.254"},
+		{prefix: "10.0.0.0/30", want: "10.0.0.1-10.0.0.2"},
+		// point-to-point links and hosts have no network or broadcast address
+		{prefix: "10.0.0.0/31", want: "10.0.0.0-10.0.0.1"},
+		{prefix: "10.0.0.7/32", want: "10.0.0.7-10.0.0.7"},
+		// IPv6 has no broadcast
+		{prefix: "2001:db8::/126", want: "2001:db8::-2001:db8::3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			if got := HostRange(netip.MustParsePrefix(tt.prefix)); got.String() != tt.want {
+				t.Errorf("HostRange() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
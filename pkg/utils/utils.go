@@ -2,12 +2,20 @@
 package utils
 
 import (
+	"bufio"
+	"context"
 	"fmt"
+	"io"
 	"net"
+	"net/netip"
 	"os"
+	"strconv"
+	"strings"
 )
 
-// GetHosts returns all IP addresses in a given CIDR range
+// GetHosts returns all IP addresses in a given CIDR range.
+// The whole list is kept in memory, use Range.All to walk large ranges.
+// The network and broadcast addresses are included, use HostRange to drop them.
 func GetHosts(cidr string) ([]string, error) {
 	ip, ipnet, err := net.ParseCIDR(cidr)
 	if err != nil {
@@ -18,8 +26,6 @@ func GetHosts(cidr string) ([]string, error) {
 	for currentIP := ip.Mask(ipnet.Mask); ipnet.Contains(currentIP); inc(currentIP) {
 		ips = append(ips, currentIP.String())
 	}
-	// remove network address and broadcast address
-	// return ips[1 : len(ips)-1], nil
 	return ips, nil
 }
 
@@ -35,7 +41,11 @@ func inc(ip net.IP) {
 // GetCIDR calculates CIDR notation from an IP range
 func GetCIDR(start, end net.IP) string {
 	var cidrString string
-	maxLen := 32
+	maxLen := 128
+	if v4 := start.To4(); v4 != nil {
+		start = v4
+		maxLen = 32
+	}
 
 	for l := maxLen; l >= 0; l-- {
 		mask := net.CIDRMask(l, maxLen)
@@ -52,15 +62,42 @@ func GetCIDR(start, end net.IP) string {
 }
 
 // ResolveName performs reverse DNS lookup for an IP address
-func ResolveName(ip string) ([]string, error) {
+func ResolveName(ctx context.Context, ip string) ([]string, error) {
 	// Try to get Neighbor DNS Names
-	names, err := net.LookupAddr(ip)
+	names, err := net.DefaultResolver.LookupAddr(ctx, ip)
 	if err != nil {
 		return nil, err
 	}
 	return names, nil
 }
 
+// ReverseName returns the in-addr.arpa or ip6.arpa name to query for the PTR records of ip
+func ReverseName(ip netip.Addr) string {
+	ip = ip.Unmap()
+
+	var b strings.Builder
+	if ip.Is4() {
+		a := ip.As4()
+		for i := len(a) - 1; i >= 0; i-- {
+			b.WriteString(strconv.Itoa(int(a[i])))
+			b.WriteByte('.')
+		}
+		b.WriteString("in-addr.arpa.")
+		return b.String()
+	}
+
+	const hexDigits = "0123456789abcdef"
+	a := ip.As16()
+	for i := len(a) - 1; i >= 0; i-- {
+		b.WriteByte(hexDigits[a[i]&0x0f])
+		b.WriteByte('.')
+		b.WriteByte(hexDigits[a[i]>>4])
+		b.WriteByte('.')
+	}
+	b.WriteString("ip6.arpa.")
+	return b.String()
+}
+
 // IsValidPath - Check if a given path is valid
 func IsValidPath(fp string) bool {
 	// Check if file already exists
@@ -80,13 +117,44 @@ func IsValidPath(fp string) bool {
 	return false
 }
 
+// ReadLines returns the non-empty lines of a file, skipping # comments
+func ReadLines(fp string) ([]string, error) {
+	f, err := os.Open(fp)
+	if err != nil {
+		return nil, err
+	}
+	//nolint:errcheck
+	defer f.Close()
+
+	return ScanLines(f)
+}
+
+// ScanLines reads r like ReadLines
+func ScanLines(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
 // IsValidIP validates an input IP address
 func IsValidIP(ip string) (net.IP, error) {
 	netIP := net.ParseIP(ip)
 	if netIP == nil {
 		return nil, fmt.Errorf("invalid IP: %q", ip)
 	}
-	return netIP.To4(), nil
+	if v4 := netIP.To4(); v4 != nil {
+		return v4, nil
+	}
+	return netIP, nil
 }
 
 // SplitSlice divides a slice into num chunks
@@ -1,7 +1,9 @@
 package utils
 
 import (
+	"context"
 	"net"
+	"net/netip"
 	"os"
 	"path/filepath"
 	"testing"
@@ -23,6 +25,11 @@ func TestIsValidIP(t *testing.T) {
 			ip:      "10.0.0.0",
 			wantErr: false,
 		},
+		{
+			name:    "valid IPv6",
+			ip:      "2001:db8::1",
+			wantErr: false,
+		},
 		{
 			name:    "invalid IP - empty",
 			ip:      "",
@@ -79,6 +86,12 @@ func TestGetCIDR(t *testing.T) {
 			end:   "10.0.0.15",
 			want:  "10.0.0.0/28",
 		},
+		{
+			name:  "IPv6 /64",
+			start: "2001:db8::",
+			end:   "2001:db8::ffff:ffff:ffff:ffff",
+			want:  "2001:db8::/64",
+		},
 	}
 
 	for _, tt := range tests {
@@ -234,10 +247,65 @@ func TestIsValidPath(t *testing.T) {
 	}
 }
 
+func TestReadLines(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "hints.txt")
+	content := "# seeds\n2001:db8::1\n\n  2001:db8::2  # router\n"
+	if err := os.WriteFile(fp, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	got, err := ReadLines(fp)
+	if err != nil {
+		t.Fatalf("ReadLines() unexpected error = %v", err)
+	}
+	want := []string{"2001:db8::1", "2001:db8::2"}
+	if len(got) != len(want) {
+		t.Fatalf("ReadLines() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("ReadLines()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestReverseName(t *testing.T) {
+	tests := []struct {
+		name string
+		ip   string
+		want string
+	}{
+		{
+			name: "IPv4",
+			ip:   "192.0.2.10",
+			want: "10.2.0.192.in-addr.arpa.",
+		},
+		{
+			name: "IPv4-mapped IPv6",
+			ip:   "::ffff:192.0.2.10",
+			want: "10.2.0.192.in-addr.arpa.",
+		},
+		{
+			name: "IPv6",
+			ip:   "2001:db8::567:89ab",
+			want: "b.a.9.8.7.6.5.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ReverseName(netip.MustParseAddr(tt.ip))
+			if got != tt.want {
+				t.Errorf("ReverseName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestResolveName(t *testing.T) {
 	// Test with localhost which should always resolve
 	t.Run("resolve localhost", func(t *testing.T) {
-		_, err := ResolveName("127.0.0.1")
+		_, err := ResolveName(context.Background(), "127.0.0.1")
 		// We don't check the result because it depends on the system configuration
 		// We just verify the function doesn't panic and returns properly
 		if err != nil {
@@ -247,7 +315,7 @@ func TestResolveName(t *testing.T) {
 	})
 
 	t.Run("resolve invalid IP", func(t *testing.T) {
-		names, err := ResolveName("999.999.999.999")
+		names, err := ResolveName(context.Background(), "999.999.999.999")
 		if err == nil && len(names) > 0 {
 			t.Errorf("ResolveName() should error on invalid IP")
 		}